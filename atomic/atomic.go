@@ -4,6 +4,8 @@ import (
 	"context"
 	"dagger/atomic/internal/dagger"
 	"fmt"
+	"maps"
+	"slices"
 )
 
 const (
@@ -19,113 +21,83 @@ var (
 		"org.opencontainers.image.url":      "https://github.com/scottames/containers/tree/main/atomic",
 	}
 
-	scriptsPostPackageInstall = []string{
-		"1Password.sh",
-		"Zed.sh",
-		"Obsidian.sh",
+	scriptsPostPackageInstall = []rule{
+		{
+			Items: []string{
+				"1Password.sh",
+				"Zed.sh",
+				"Obsidian.sh",
+			},
+		},
 	}
 )
 
 // fedoraAtomic defines the custom Fedora Atomic container image
 //
-// the container and publish functions both refer to this as their source
-func (a *Atomic) fedoraAtomic(ctx context.Context) (*dagger.Fedora, error) {
-	scriptsPost := []*dagger.File{}
-	for _, script := range scriptsPostPackageInstall {
-		scriptsPost = append(scriptsPost, a.Source.File(
-			fmt.Sprintf(
-				"atomic/scripts/%s",
-				script,
-			),
-		))
-	}
-
-	opts := dagger.FedoraOpts{
-		Registry: a.Registry,
-		Org:      a.Org,
-		Tag:      a.Tag,
-		Variant:  a.Variant,
-	}
-
-	// Niri is Silverblue-based - it should be labeled Niri,
-	//  but pulled from Silverblue
-	if opts.Variant == Niri {
-		opts.Variant = Silverblue
+// the container and publish functions both refer to this as their source,
+// in locked mode the packages of the lockfile are installed and the
+// resulting image is verified against it
+func (a *Atomic) fedoraAtomic(ctx context.Context) (*dagger.Container, *buildPlan, error) {
+	fedora, plan, err := a.plan(ctx)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if a.Suffix != nil {
-		opts.Suffix = *a.Suffix
+	if !a.Locked {
+		return a.build(fedora, plan).Container(), plan, nil
 	}
 
-	fedora := dag.Fedora(opts)
-
-	version, err := fedora.ReleaseVersion(ctx)
+	lock, err := a.lockfile(ctx, plan)
 	if err != nil {
-		version, err = fedora.Date(ctx)
-		if err != nil {
-			return nil, err
-		}
+		return nil, nil, err
 	}
 
-	a.ReleaseVersion = version
-
-	a.Tags, err = fedora.DefaultTags(ctx,
-		dagger.FedoraDefaultTagsOpts{Latest: latestFedoraVersion == version},
-	)
-	if err != nil {
-		return nil, err
-	}
+	path := lockfilePath(plan)
+	lockPlan(plan, lock, path)
 
-	fedora, err = a.fedoraWithLabelsFromCLI(fedora)
-	if err != nil {
-		return nil, err
+	ctr := a.build(fedora, plan).Container()
+	if err := verifyLock(ctx, ctr, lock, path); err != nil {
+		return nil, nil, err
 	}
 
-	if !a.SkipDefaultLabels {
-		fedora, err = a.fedoraWithDefaultLabels(ctx, fedora)
-		if err != nil {
-			return nil, err
-		}
+	return ctr, plan, nil
+}
 
-		fedora = fedora.WithDescription(description)
+// build applies the given plan to the base Fedora object
+func (a *Atomic) build(fedora *dagger.Fedora, plan *buildPlan) *dagger.Fedora {
+	for _, name := range slices.Sorted(maps.Keys(plan.Labels)) {
+		fedora = fedora.WithLabel(name, plan.Labels[name])
 	}
 
-	finalReposForBuild := replaceStringInSlice(
-		reposForBuild,
-		"FEDORA_MAJOR_VERSION",
-		version,
-	)
-
-	finalReposForImage := replaceStringInSlice(
-		reposForImage,
-		"FEDORA_MAJOR_VERSION",
-		version,
-	)
+	scriptsPost := []*dagger.File{}
+	for _, script := range plan.Scripts {
+		scriptsPost = append(scriptsPost, a.Source.File(
+			fmt.Sprintf(
+				"atomic/scripts/%s",
+				script.Name,
+			),
+		))
+	}
 
 	// Fedora is derived from the installed dagger module dependency
 	return fedora.
-			WithDescription(description).
-			WithDirectory(
-				"/usr",
-				a.Source.Directory("atomic/files/usr"),
-			).
-			// true => keep repo in final image
-			WithReposFromUrls(finalReposForImage, true).
-			// false => delete repo file in final image
-			WithReposFromUrls(finalReposForBuild, false).
-			WithPackagesInstalled(
-				a.getPackageListFrom(packagesInstalled),
-			).
-			WithPackagesRemoved(
-				a.getPackageListFrom(packagesRemoved),
-			).
-			WithExecScripts(
-				scriptsPost,
-				false, // false => post package install
-			).
-			WithExec(
-				[]string{"update-ca-trust"},
-				false, // false => post package install
-			),
-		nil
+		WithDescription(description).
+		WithDirectory(
+			"/usr",
+			a.Source.Directory("atomic/files/usr"),
+		).
+		// true => keep repo in final image
+		WithReposFromUrls(plan.ReposForImage.names(), true).
+		// false => delete repo file in final image
+		WithReposFromUrls(plan.ReposForBuild.names(), false).
+		WithPackagesInstalled(plan.PackagesInstalled.names()).
+		WithPackagesRemoved(plan.PackagesRemoved.names()).
+		WithExecScripts(
+			scriptsPost,
+			false, // false => post package install
+		).
+		WithExec(
+			[]string{"update-ca-trust"},
+			false, // false => post package install
+		)
 }
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"dagger/atomic/internal/dagger"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// cosign attest predicate types, see cosign attest --help
+	attestSbomType       = "spdxjson"
+	attestProvenanceType = "slsaprovenance1"
+
+	sourceRepository    = "https://github.com/scottames/containers"
+	provenanceBuilderID = sourceRepository + "/atomic"
+	provenanceBuildType = sourceRepository + "/atomic/buildtypes/dagger@v1"
+)
+
+// provenanceDependency is a SLSA v1 resource descriptor
+type provenanceDependency struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// provenance is a SLSA v1 provenance predicate
+type provenance struct {
+	BuildDefinition struct {
+		BuildType            string                 `json:"buildType"`
+		ExternalParameters   map[string]any         `json:"externalParameters"`
+		InternalParameters   map[string]any         `json:"internalParameters"`
+		ResolvedDependencies []provenanceDependency `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Metadata struct {
+			StartedOn  string `json:"startedOn"`
+			FinishedOn string `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// provenanceInput is everything recorded in the provenance predicate
+type provenanceInput struct {
+	// Revision is the git commit of the source, if known
+	Revision string
+	// BaseImage is the base image reference including its digest
+	BaseImage  string
+	Parameters map[string]any
+	Plan       *buildPlan
+	Packages   []sbomComponent
+	StartedOn  time.Time
+	FinishedOn time.Time
+}
+
+// newProvenance returns the provenance predicate for the given input
+func newProvenance(in provenanceInput) *provenance {
+	p := &provenance{}
+	p.BuildDefinition.BuildType = provenanceBuildType
+	p.BuildDefinition.ExternalParameters = in.Parameters
+	p.BuildDefinition.InternalParameters = map[string]any{
+		"reposForBuild":     in.Plan.ReposForBuild.names(),
+		"reposForImage":     in.Plan.ReposForImage.names(),
+		"packagesInstalled": in.Plan.PackagesInstalled.names(),
+		"packagesRemoved":   in.Plan.PackagesRemoved.names(),
+		"scripts":           in.Plan.Scripts.names(),
+	}
+
+	deps := []provenanceDependency{}
+	if in.Revision != "" {
+		deps = append(deps, provenanceDependency{
+			Name:   "source",
+			URI:    "git+" + sourceRepository,
+			Digest: map[string]string{"gitCommit": in.Revision},
+		})
+	}
+
+	if in.BaseImage != "" {
+		dep := provenanceDependency{Name: "baseImage", URI: "docker://" + in.BaseImage}
+		if ref, digest, found := strings.Cut(in.BaseImage, "@"); found {
+			algorithm, hex, _ := strings.Cut(digest, ":")
+			dep.URI = "docker://" + ref
+			dep.Digest = map[string]string{algorithm: hex}
+		}
+		deps = append(deps, dep)
+	}
+
+	for _, pkg := range in.Packages {
+		deps = append(deps, provenanceDependency{Name: pkg.Name, URI: pkg.Purl})
+	}
+
+	p.BuildDefinition.ResolvedDependencies = deps
+	p.RunDetails.Builder.ID = provenanceBuilderID
+	p.RunDetails.Metadata.StartedOn = in.StartedOn.UTC().Format(time.RFC3339)
+	p.RunDetails.Metadata.FinishedOn = in.FinishedOn.UTC().Format(time.RFC3339)
+
+	return p
+}
+
+// parseGitHead returns the commit of a detached .git/HEAD, or the ref it
+// points to, e.g. refs/heads/main
+func parseGitHead(head string) (commit string, ref string) {
+	head = strings.TrimSpace(head)
+	if ref, found := strings.CutPrefix(head, "ref: "); found {
+		return "", ref
+	}
+
+	return head, ""
+}
+
+// packedGitRef returns the commit of ref in the contents of .git/packed-refs
+func packedGitRef(packedRefs, ref string) string {
+	for _, line := range strings.Split(packedRefs, "\n") {
+		commit, name, found := strings.Cut(strings.TrimSpace(line), " ")
+		if found && name == ref {
+			return commit
+		}
+	}
+
+	return ""
+}
+
+// gitRevision returns the commit checked out in dir, empty if dir is not a
+// git checkout
+func gitRevision(ctx context.Context, dir *dagger.Directory) string {
+	read := func(path string) string {
+		found, err := dir.Glob(ctx, path)
+		if err != nil || len(found) == 0 {
+			return ""
+		}
+
+		contents, err := dir.File(path).Contents(ctx)
+		if err != nil {
+			return ""
+		}
+
+		return contents
+	}
+
+	commit, ref := parseGitHead(read(".git/HEAD"))
+	if ref == "" {
+		return commit
+	}
+
+	if commit := strings.TrimSpace(read(".git/" + ref)); commit != "" {
+		return commit
+	}
+
+	return packedGitRef(read(".git/packed-refs"), ref)
+}
+
+// digestRefs returns the unique digest references of the published image
+// references, e.g. ghcr.io/foo/bar:43@sha256:... => ghcr.io/foo/bar@sha256:...
+func digestRefs(refs []string) []string {
+	result := []string{}
+	for _, ref := range refs {
+		_, digest, found := strings.Cut(ref, "@")
+		if !found {
+			continue
+		}
+
+		ref = imageRepository(ref) + "@" + digest
+		if !slices.Contains(result, ref) {
+			result = append(result, ref)
+		}
+	}
+
+	return result
+}
+
+// cosignOpts configures the cosign container
+type cosignOpts struct {
+	Image            string
+	User             string
+	PrivateKey       *dagger.Secret
+	Password         *dagger.Secret
+	Registry         string
+	RegistryUsername string
+	RegistryPassword *dagger.Secret
+	DockerConfig     *dagger.File
+	RegistryService  *dagger.Service
+	// SkipTlog signs without uploading to the transparency log, e.g. images
+	// of an ephemeral registry
+	SkipTlog bool
+}
+
+// cosignContainer returns a cosign container authenticated to the registry
+// with the private key, if any, mounted at /cosign/cosign.key
+func cosignContainer(ctx context.Context, opts cosignOpts) (*dagger.Container, error) {
+	ctr := dag.Container().
+		From(opts.Image).
+		WithUser(opts.User)
+
+	if opts.PrivateKey != nil {
+		ctr = ctr.
+			WithMountedSecret(
+				"/cosign/cosign.key",
+				opts.PrivateKey,
+				dagger.ContainerWithMountedSecretOpts{Owner: opts.User},
+			).
+			WithSecretVariable("COSIGN_PASSWORD", opts.Password)
+	}
+
+	return withDockerConfig(ctx, ctr, registryAuth{
+		User:         opts.User,
+		Login:        []string{"cosign", "login"},
+		Registry:     opts.Registry,
+		Username:     opts.RegistryUsername,
+		Password:     opts.RegistryPassword,
+		DockerConfig: opts.DockerConfig,
+		Service:      opts.RegistryService,
+	})
+}
+
+// registryAuth is how a tool container authenticates to the registry
+type registryAuth struct {
+	// User is the container user owning the docker config
+	User string
+	// Login is the command of the container logging in to the registry,
+	// e.g. cosign login
+	Login        []string
+	Registry     string
+	Username     string
+	Password     *dagger.Secret
+	DockerConfig *dagger.File
+	// Service is bound as "registry" and reached over plain HTTP, e.g. a
+	// local registry:2 service
+	Service *dagger.Service
+}
+
+// registryPasswordPath is where the registry password is mounted for the
+// login of withDockerConfig
+const registryPasswordPath = "/run/secrets/registry-password"
+
+// withDockerConfig mounts the docker config, or logs in to the registry with
+// the password to write one, at $DOCKER_CONFIG=/docker and binds the registry
+// service, if any. The password is only read inside the container
+func withDockerConfig(
+	ctx context.Context,
+	ctr *dagger.Container,
+	auth registryAuth,
+) (*dagger.Container, error) {
+	ctr = ctr.WithEnvVariable("DOCKER_CONFIG", "/docker")
+	if auth.Service != nil {
+		ctr = ctr.WithServiceBinding("registry", auth.Service)
+	}
+
+	switch {
+	case auth.DockerConfig != nil:
+		ctr = ctr.WithMountedFile(
+			"/docker/config.json",
+			auth.DockerConfig,
+			dagger.ContainerWithMountedFileOpts{Owner: auth.User},
+		)
+	case auth.Password != nil:
+		login := append(slices.Clone(auth.Login),
+			auth.Registry, "--username", auth.Username, "--password-stdin")
+
+		ctr = ctr.
+			WithDirectory("/docker", dag.Directory(), dagger.ContainerWithDirectoryOpts{Owner: auth.User}).
+			WithMountedSecret(
+				registryPasswordPath,
+				auth.Password,
+				dagger.ContainerWithMountedSecretOpts{Owner: auth.User},
+			).
+			WithExec(login, dagger.ContainerWithExecOpts{RedirectStdin: registryPasswordPath}).
+			WithoutMount(registryPasswordPath)
+
+		if _, err := ctr.Sync(ctx); err != nil {
+			return nil, fmt.Errorf("unable to log in to %s as %s: %w", auth.Registry, auth.Username, err)
+		}
+	}
+
+	return ctr, nil
+}
+
+// cosignArgs returns the cosign command signing or attesting with the opts:
+// a bound registry service is reached over plain HTTP and SkipTlog skips the
+// transparency log
+func cosignArgs(opts cosignOpts, command string, args ...string) []string {
+	cmd := []string{"cosign", command}
+	if opts.RegistryService != nil {
+		cmd = append(cmd, "--allow-insecure-registry", "--allow-http-registry")
+	}
+	if opts.SkipTlog {
+		cmd = append(cmd, "--tlog-upload=false")
+	}
+
+	return append(cmd, args...)
+}
+
+// sign signs each of the digests with the cosign key
+func sign(ctx context.Context, opts cosignOpts, digests []string) error {
+	ctr, err := cosignContainer(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, digest := range digestRefs(digests) {
+		_, err := ctr.
+			WithExec(cosignArgs(opts, "sign", "--yes", "--key", "/cosign/cosign.key", digest)).
+			Sync(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to sign %s: %w", digest, err)
+		}
+	}
+
+	return nil
+}
+
+// attest creates and attaches an attestation of each predicate type to each
+// of the digests, signed with the cosign key
+func attest(
+	ctx context.Context,
+	opts cosignOpts,
+	digests []string,
+	// predicate type => predicate
+	predicates map[string]*dagger.File,
+) error {
+	ctr, err := cosignContainer(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, digest := range digestRefs(digests) {
+		for _, predicateType := range slices.Sorted(maps.Keys(predicates)) {
+			path := fmt.Sprintf("/predicates/%s.json", predicateType)
+			_, err := ctr.
+				WithMountedFile(path, predicates[predicateType]).
+				WithExec(cosignArgs(
+					opts,
+					"attest",
+					"--yes",
+					"--key", "/cosign/cosign.key",
+					"--type", predicateType,
+					"--predicate", path,
+					digest,
+				)).
+				Sync(ctx)
+			if err != nil {
+				return fmt.Errorf("unable to attest %s to %s: %w", predicateType, digest, err)
+			}
+		}
+	}
+
+	return nil
+}
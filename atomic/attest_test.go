@@ -0,0 +1,132 @@
+package main
+
+import (
+	"dagger/atomic/internal/dagger"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNewProvenance(t *testing.T) {
+	t.Parallel()
+
+	plan := &buildPlan{
+		PackagesInstalled: plannedItems{{Name: "fish"}},
+		PackagesRemoved:   plannedItems{{Name: "opensc"}},
+	}
+
+	p := newProvenance(provenanceInput{
+		Revision:   "0123456789abcdef",
+		BaseImage:  "quay.io/fedora-ostree-desktops/silverblue:43@sha256:abc",
+		Parameters: map[string]any{"variant": "silverblue"},
+		Plan:       plan,
+		Packages: []sbomComponent{
+			{Name: "fish", Purl: "pkg:rpm/fedora/fish@3.7.1-5.fc43?arch=x86_64"},
+		},
+		StartedOn:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		FinishedOn: time.Date(2026, 1, 2, 4, 4, 5, 0, time.UTC),
+	})
+
+	want := []provenanceDependency{
+		{
+			Name:   "source",
+			URI:    "git+https://github.com/scottames/containers",
+			Digest: map[string]string{"gitCommit": "0123456789abcdef"},
+		},
+		{
+			Name:   "baseImage",
+			URI:    "docker://quay.io/fedora-ostree-desktops/silverblue:43",
+			Digest: map[string]string{"sha256": "abc"},
+		},
+		{Name: "fish", URI: "pkg:rpm/fedora/fish@3.7.1-5.fc43?arch=x86_64"},
+	}
+
+	got := p.BuildDefinition.ResolvedDependencies
+	if len(got) != len(want) {
+		t.Fatalf("ResolvedDependencies = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || got[i].URI != want[i].URI ||
+			len(got[i].Digest) != len(want[i].Digest) {
+			t.Fatalf("ResolvedDependencies[%d] = %v, want %v", i, got[i], want[i])
+		}
+		for k, v := range want[i].Digest {
+			if got[i].Digest[k] != v {
+				t.Fatalf("ResolvedDependencies[%d].Digest = %v, want %v", i, got[i].Digest, want[i].Digest)
+			}
+		}
+	}
+
+	if got := p.BuildDefinition.InternalParameters["packagesRemoved"]; !slices.Equal(got.([]string), []string{"opensc"}) {
+		t.Fatalf("InternalParameters.packagesRemoved = %v, want [opensc]", got)
+	}
+	if got := p.RunDetails.Metadata.FinishedOn; got != "2026-01-02T04:04:05Z" {
+		t.Fatalf("FinishedOn = %q, want %q", got, "2026-01-02T04:04:05Z")
+	}
+}
+
+func TestGitRevision(t *testing.T) {
+	t.Parallel()
+
+	if commit, ref := parseGitHead("0123456789abcdef\n"); commit != "0123456789abcdef" || ref != "" {
+		t.Fatalf("parseGitHead(detached) = %q, %q", commit, ref)
+	}
+
+	commit, ref := parseGitHead("ref: refs/heads/main\n")
+	if commit != "" || ref != "refs/heads/main" {
+		t.Fatalf("parseGitHead(branch) = %q, %q", commit, ref)
+	}
+
+	packed := "# pack-refs with: peeled fully-peeled sorted\n" +
+		"aaaa refs/heads/feature\n" +
+		"bbbb refs/heads/main\n"
+	if got := packedGitRef(packed, ref); got != "bbbb" {
+		t.Fatalf("packedGitRef() = %q, want %q", got, "bbbb")
+	}
+	if got := packedGitRef(packed, "refs/heads/missing"); got != "" {
+		t.Fatalf("packedGitRef(missing) = %q, want empty", got)
+	}
+}
+
+func TestDigestRefs(t *testing.T) {
+	t.Parallel()
+
+	got := digestRefs([]string{
+		"ghcr.io/foo/atomic:43@sha256:abc",
+		"ghcr.io/foo/atomic:latest@sha256:abc",
+		"localhost:5000/atomic@sha256:def",
+		"ghcr.io/foo/atomic:no-digest",
+	})
+
+	want := []string{
+		"ghcr.io/foo/atomic@sha256:abc",
+		"localhost:5000/atomic@sha256:def",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("digestRefs() = %v, want %v", got, want)
+	}
+}
+
+func TestCosignArgs(t *testing.T) {
+	t.Parallel()
+
+	got := cosignArgs(cosignOpts{}, "sign", "--yes", "ghcr.io/foo/bar@sha256:abc")
+	if want := []string{"cosign", "sign", "--yes", "ghcr.io/foo/bar@sha256:abc"}; !slices.Equal(got, want) {
+		t.Fatalf("cosignArgs() = %q, want %q", got, want)
+	}
+
+	got = cosignArgs(
+		cosignOpts{RegistryService: &dagger.Service{}, SkipTlog: true},
+		"attest",
+		"registry:5000/bar@sha256:abc",
+	)
+	want := []string{
+		"cosign", "attest",
+		"--allow-insecure-registry", "--allow-http-registry",
+		"--tlog-upload=false",
+		"registry:5000/bar@sha256:abc",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("cosignArgs() = %q, want %q", got, want)
+	}
+}
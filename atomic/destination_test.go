@@ -0,0 +1,92 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDestinationRefs(t *testing.T) {
+	t.Parallel()
+
+	tags := []string{"43", "43-20261018", "20261018"}
+
+	tests := []struct {
+		name        string
+		destination Destination
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name:        "all tags",
+			destination: Destination{Registry: "ghcr.io", Namespace: "Foo"},
+			want: []string{
+				"ghcr.io/foo/atomic:43",
+				"ghcr.io/foo/atomic:43-20261018",
+				"ghcr.io/foo/atomic:20261018",
+			},
+		},
+		{
+			name:        "tag subset without namespace",
+			destination: Destination{Registry: "registry.internal:5000", Tags: []string{"43"}},
+			want:        []string{"registry.internal:5000/atomic:43"},
+		},
+		{
+			name:        "tag not published",
+			destination: Destination{Registry: "quay.io", Namespace: "foo", Tags: []string{"latest"}},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tt.destination.refs("atomic", tags)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("refs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("refs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSigningConfigCoversDestinations(t *testing.T) {
+	t.Parallel()
+
+	refs := []string{
+		"ghcr.io/foo/atomic:43",
+		"ghcr.io/foo/atomic:20261018",
+		"quay.io/foo/atomic:43",
+		"registry.internal:5000/atomic:43",
+	}
+
+	requirements, err := signingRequirements(
+		refs,
+		signedIdentityMatchRepository,
+		"",
+		[]string{"/etc/pki/containers/atomic.pub"},
+	)
+	if err != nil {
+		t.Fatalf("signingRequirements() unexpected error: %v", err)
+	}
+
+	for _, ref := range refs {
+		if _, ok := requirements[imageRepository(ref)]; !ok {
+			t.Errorf("pushed ref %s has no policy scope", ref)
+		}
+	}
+
+	want := `docker:
+  ghcr.io/foo:
+      use-sigstore-attachments: true
+  quay.io/foo:
+      use-sigstore-attachments: true
+  registry.internal:5000:
+      use-sigstore-attachments: true
+`
+	if got := sigstoreAttachments(refs); got != want {
+		t.Errorf("sigstoreAttachments() =\n%s\nwant\n%s", got, want)
+	}
+}
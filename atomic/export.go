@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"dagger/atomic/internal/dagger"
+)
+
+// busyboxImage unpacks image tarballs
+const busyboxImage = "cgr.dev/chainguard/busybox:latest"
+
+// finalize labels the image with its title and commits the ostree container,
+// the last step before the image leaves the pipeline
+func finalize(ctr *dagger.Container, imageName string) *dagger.Container {
+	return ostreeCommit(ctr.WithLabel("org.opencontainers.image.title", imageName))
+}
+
+// ostreeCommit commits the ostree container
+func ostreeCommit(ctr *dagger.Container) *dagger.Container {
+	// NOTE: this must be the last thing to run prior to publishing
+	return ctr.WithExec([]string{"ostree", "container", "commit"})
+}
+
+// exportImage returns the finalized image, the signing config is not added as
+// there are no published references
+func (a *Atomic) exportImage(
+	ctx context.Context,
+	imageName string,
+) (*dagger.Container, error) {
+	ctr, _, err := a.fedoraAtomic(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return finalize(ctr, imageName), nil
+}
+
+// ociLayout returns the OCI image layout of the image
+func ociLayout(ctr *dagger.Container) *dagger.Directory {
+	tarball := ctr.AsTarball(dagger.ContainerAsTarballOpts{
+		MediaTypes: dagger.ImageMediaTypesOcimediaTypes,
+	})
+
+	return dag.Container().
+		From(busyboxImage).
+		WithMountedFile("/tmp/image.tar", tarball).
+		WithExec([]string{"mkdir", "-p", "/tmp/oci"}).
+		WithExec([]string{"tar", "-xf", "/tmp/image.tar", "-C", "/tmp/oci"}).
+		Directory("/tmp/oci")
+}
+
+// ExportOci returns the Fedora Atomic image as an OCI image layout, e.g. for
+// rpm-ostree rebase ostree-unverified-image:oci:<dir> on an air-gapped machine
+func (a *Atomic) ExportOci(
+	ctx context.Context,
+	// name of the image, used as the image title
+	imageName string,
+) (*dagger.Directory, error) {
+	ctr, err := a.exportImage(ctx, imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	return ociLayout(ctr), nil
+}
+
+// ExportArchive returns the Fedora Atomic image as a docker-archive, e.g. for
+// podman load
+func (a *Atomic) ExportArchive(
+	ctx context.Context,
+	// name of the image, used as the image title
+	imageName string,
+) (*dagger.File, error) {
+	ctr, err := a.exportImage(ctx, imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctr.AsTarball(dagger.ContainerAsTarballOpts{
+		MediaTypes: dagger.ImageMediaTypesDockerMediaTypes,
+	}), nil
+}
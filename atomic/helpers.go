@@ -1,16 +1,24 @@
 package main
 
-import "strings"
+import (
+	"dagger/atomic/internal/dagger"
+	"strings"
+)
 
-// replaceStringInSlice simple helper to replace a given string in a slice of
-// strings
-func replaceStringInSlice(ss []string, replace string, with string) []string {
-	result := []string{}
-	for _, r := range ss {
-		result = append(result, strings.Replace(
-			r, replace, with, -1),
-		)
+// archFromPlatform returns the rpm architecture of the given platform,
+// e.g. linux/amd64 => x86_64
+func archFromPlatform(platform dagger.Platform) string {
+	parts := strings.Split(string(platform), "/")
+	if len(parts) < 2 {
+		return string(platform)
 	}
 
-	return result
+	switch parts[1] {
+	case "amd64":
+		return "x86_64"
+	case "arm64":
+		return "aarch64"
+	}
+
+	return parts[1]
 }
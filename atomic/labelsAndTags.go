@@ -1,68 +1,57 @@
 package main
 
 import (
-	"context"
-	"dagger/atomic/internal/dagger"
 	"fmt"
 	"strings"
 )
 
-// fedoraWithLabelsFromCLI returns the provided Fedora object with the labels
-// from the CLI added
-func (a *Atomic) fedoraWithLabelsFromCLI(
-	fedora *dagger.Fedora,
-) (*dagger.Fedora, error) {
-	for _, l := range a.Labels {
+// labelsFromCLI returns the key=value labels from the CLI as a map
+func labelsFromCLI(cliLabels []string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, l := range cliLabels {
 		ll := strings.SplitN(l, "=", 2)
 		if len(ll) < 2 {
-			return nil, fmt.Errorf("invalid label: %s", ll)
+			return nil, fmt.Errorf("invalid label, want key=value: %s", l)
 		}
 
-		fedora = fedora.WithLabel(ll[0], ll[1])
+		result[ll[0]] = ll[1]
 	}
 
-	return fedora, nil
+	return result, nil
 }
 
-// fedoraWithDefaultLabels returns the provided Fedora object with pre-defined
-// labels added:
+// defaultLabels returns the pre-defined labels:
 //
 //	org.opencontainers.image.version
-//	org.opencontainers.image.base_image
-//	org.opencontainers.image.base_image_version
+//	org.opencontainers.image.base_image (if known)
+//	org.opencontainers.image.base_image_version (if known)
 //	io.artifacthub.package.logo-url (if org=ublue-os)
-func (a *Atomic) fedoraWithDefaultLabels(
-	ctx context.Context,
-	fedora *dagger.Fedora,
-) (*dagger.Fedora, error) {
-	// note: universal blue appends a build number, we do not
-	fedora = fedora.WithLabel(
-		"org.opencontainers.image.version",
-		a.ReleaseVersion,
-	)
+func defaultLabels(
+	org string,
+	releaseVersion string,
+	baseImage string,
+	baseImageVersion string,
+) map[string]string {
+	result := map[string]string{
+		// note: universal blue appends a build number, we do not
+		"org.opencontainers.image.version": releaseVersion,
+	}
 
-	if a.Org == "ublue-os" {
-		fedora = fedora.WithLabel(
-			"io.artifacthub.package.logo-url",
-			"https://avatars.githubusercontent.com/u/120078124?s=200&v=4",
-		)
+	if org == "ublue-os" {
+		result["io.artifacthub.package.logo-url"] = "https://avatars.githubusercontent.com/u/120078124?s=200&v=4"
 	}
-	baseImage, err := fedora.BaseImage(ctx)
-	if err == nil {
-		fedora = fedora.WithLabel("org.opencontainers.image.base_image", baseImage)
+
+	if baseImage != "" {
+		result["org.opencontainers.image.base_image"] = baseImage
 	}
 
-	baseImageVersion, err := fedora.BaseImageVersion(ctx)
-	if err == nil {
-		fedora = fedora.WithLabel(
-			"org.opencontainers.image.base_image_version",
-			baseImageVersion,
-		)
+	if baseImageVersion != "" {
+		result["org.opencontainers.image.base_image_version"] = baseImageVersion
 	}
 
 	for k, v := range labels {
-		fedora = fedora.WithLabel(k, v)
+		result[k] = v
 	}
 
-	return fedora, nil
+	return result
 }
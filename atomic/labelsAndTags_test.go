@@ -0,0 +1,79 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestLabelsFromCLI(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		labels  []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "none",
+			want: map[string]string{},
+		},
+		{
+			name:   "key value",
+			labels: []string{"org.opencontainers.image.revision=abc", "empty="},
+			want: map[string]string{
+				"org.opencontainers.image.revision": "abc",
+				"empty":                             "",
+			},
+		},
+		{
+			name:   "value with equals",
+			labels: []string{"io.artifacthub.package.keywords=a=b"},
+			want:   map[string]string{"io.artifacthub.package.keywords": "a=b"},
+		},
+		{
+			name:    "no value",
+			labels:  []string{"org.opencontainers.image.revision"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := labelsFromCLI(tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("labelsFromCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("labelsFromCLI() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultLabels(t *testing.T) {
+	t.Parallel()
+
+	got := defaultLabels("scottames", "43", "", "")
+	if got["org.opencontainers.image.version"] != "43" {
+		t.Errorf("org.opencontainers.image.version = %q, want 43", got["org.opencontainers.image.version"])
+	}
+	for _, name := range []string{
+		"io.artifacthub.package.logo-url",
+		"org.opencontainers.image.base_image",
+		"org.opencontainers.image.base_image_version",
+	} {
+		if _, ok := got[name]; ok {
+			t.Errorf("defaultLabels() has %s, want it unset", name)
+		}
+	}
+
+	got = defaultLabels("ublue-os", "43", "ghcr.io/ublue-os/silverblue-main:43", "43.20261018.0")
+	if got["org.opencontainers.image.base_image"] != "ghcr.io/ublue-os/silverblue-main:43" ||
+		got["org.opencontainers.image.base_image_version"] != "43.20261018.0" ||
+		got["io.artifacthub.package.logo-url"] == "" {
+		t.Errorf("defaultLabels() = %v", got)
+	}
+}
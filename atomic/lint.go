@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"dagger/atomic/internal/dagger"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+const (
+	// lintSeverityError findings fail publish unless skipLint is set
+	lintSeverityError = "error"
+	// lintSeverityWarning findings are reported only
+	lintSeverityWarning = "warning"
+
+	// lintMaxPaths is the number of paths a finding lists
+	lintMaxPaths = 20
+)
+
+// LintFinding is a problem found linting the bootable container image
+type LintFinding struct {
+	// Check that reported the finding, e.g. bootc or var
+	Check string
+	// Severity is error or warning, errors fail publish
+	Severity string
+	Message  string
+	// Paths the finding is about, at most lintMaxPaths
+	Paths []string
+}
+
+// lintCheck is a check run inside the image, findings parses its exit code
+// and output
+type lintCheck struct {
+	Name     string
+	Script   string
+	findings func(exitCode int, stdout, stderr string) []*LintFinding
+}
+
+// lintChecks are the checks run by Lint
+var lintChecks = []lintCheck{
+	{
+		Name:     "bootc",
+		Script:   `bootc container lint`,
+		findings: bootcFindings,
+	},
+	{
+		Name: "var",
+		// ostree deploys /var once, content shipped in it is never updated
+		Script: `find /var -mindepth 1 ! -type d 2>/dev/null | sort`,
+		findings: func(_ int, stdout, _ string) []*LintFinding {
+			return pathFindings("var", lintSeverityWarning,
+				"content in /var is only deployed on the first boot, later updates lose it, use tmpfiles.d or /usr", stdout)
+		},
+	},
+	{
+		Name: "runtime",
+		// the engine mounts secrets, sockets and caches below /run and /tmp,
+		// only the root filesystem of the image is checked
+		Script: `root=$(stat -c %d /)
+for dir in /run /tmp; do
+  [ "$(stat -c %d "$dir")" = "$root" ] && find "$dir" -xdev -mindepth 1 2>/dev/null
+done | grep -vxF -f <(awk '{ print $2 }' /proc/mounts) | sort`,
+		findings: func(_ int, stdout, _ string) []*LintFinding {
+			return pathFindings("runtime", lintSeverityWarning,
+				"stray files in /run or /tmp, these are tmpfs on the booted system", stdout)
+		},
+	},
+	{
+		Name:     "kernel",
+		Script:   `find /usr/lib/modules -mindepth 2 -maxdepth 2 \( -name vmlinuz -o -name initramfs.img \) 2>/dev/null | sort`,
+		findings: func(_ int, stdout, _ string) []*LintFinding { return kernelFindings(stdout) },
+	},
+	{
+		Name: "etc",
+		// files of /usr/etc shadowed by a different /etc file of the image
+		Script: `[ -d /usr/etc ] || exit 0
+cd /usr/etc && find . -type f | sort | while read -r f; do
+  if [ -e "/etc/$f" ] && ! cmp -s "$f" "/etc/$f"; then echo "/usr/etc/${f#./}"; fi
+done`,
+		findings: func(_ int, stdout, _ string) []*LintFinding {
+			return pathFindings("etc", lintSeverityWarning,
+				"files of /usr/etc differ from the /etc of the image, /etc wins on deployed systems", stdout)
+		},
+	},
+}
+
+// bootcFindings returns the findings of bootc container lint, an error if it
+// failed and a warning per warning it printed
+func bootcFindings(exitCode int, stdout, stderr string) []*LintFinding {
+	if exitCode == 127 {
+		return []*LintFinding{{
+			Check:    "bootc",
+			Severity: lintSeverityWarning,
+			Message:  "bootc is not installed, bootc container lint was skipped",
+		}}
+	}
+
+	findings := []*LintFinding{}
+	for _, line := range strings.Split(stdout+"\n"+stderr, "\n") {
+		warning, ok := strings.CutPrefix(strings.TrimSpace(line), "Lint warning:")
+		if ok {
+			findings = append(findings, &LintFinding{
+				Check:    "bootc",
+				Severity: lintSeverityWarning,
+				Message:  strings.TrimSpace(warning),
+			})
+		}
+	}
+
+	if exitCode != 0 {
+		message := lastLine(stderr)
+		if message == "" {
+			message = fmt.Sprintf("bootc container lint exited with %d", exitCode)
+		}
+
+		findings = append(findings, &LintFinding{
+			Check:    "bootc",
+			Severity: lintSeverityError,
+			Message:  message,
+		})
+	}
+
+	return findings
+}
+
+// pathFindings returns a finding listing the paths, one per line, if any
+func pathFindings(check string, severity string, message string, listing string) []*LintFinding {
+	paths := strings.Fields(listing)
+	if len(paths) == 0 {
+		return nil
+	}
+
+	finding := &LintFinding{
+		Check:    check,
+		Severity: severity,
+		Message:  fmt.Sprintf("%s (%d paths)", message, len(paths)),
+		Paths:    paths[:min(len(paths), lintMaxPaths)],
+	}
+
+	return []*LintFinding{finding}
+}
+
+// kernelFindings returns an error finding if no kernel is installed or a
+// kernel has no initramfs, listing is the vmlinuz and initramfs.img files of
+// /usr/lib/modules
+func kernelFindings(listing string) []*LintFinding {
+	kernels := []string{}
+	initramfs := []string{}
+	for _, file := range strings.Fields(listing) {
+		switch path.Base(file) {
+		case "vmlinuz":
+			kernels = append(kernels, path.Dir(file))
+		case "initramfs.img":
+			initramfs = append(initramfs, path.Dir(file))
+		}
+	}
+
+	if len(kernels) == 0 {
+		return []*LintFinding{{
+			Check:    "kernel",
+			Severity: lintSeverityError,
+			Message:  "no kernel found in /usr/lib/modules",
+		}}
+	}
+
+	findings := []*LintFinding{}
+	for _, kernel := range kernels {
+		if !slices.Contains(initramfs, kernel) {
+			findings = append(findings, &LintFinding{
+				Check:    "kernel",
+				Severity: lintSeverityError,
+				Message:  "kernel has no initramfs.img",
+				Paths:    []string{path.Join(kernel, "vmlinuz")},
+			})
+		}
+	}
+
+	return findings
+}
+
+// lint runs the lint checks in the committed ostree container ctr
+func lint(ctx context.Context, ctr *dagger.Container) ([]*LintFinding, error) {
+	findings := []*LintFinding{}
+	for _, check := range lintChecks {
+		run := ctr.WithExec(
+			[]string{"bash", "-c", check.Script},
+			dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny},
+		)
+
+		exitCode, err := run.ExitCode(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to run lint check %s: %w", check.Name, err)
+		}
+
+		stdout, err := run.Stdout(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to run lint check %s: %w", check.Name, err)
+		}
+
+		stderr, err := run.Stderr(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to run lint check %s: %w", check.Name, err)
+		}
+
+		findings = append(findings, check.findings(exitCode, stdout, stderr)...)
+	}
+
+	return findings, nil
+}
+
+// lintError returns an error listing the error findings, if any
+func lintError(findings []*LintFinding) error {
+	errors := []string{}
+	for _, finding := range findings {
+		if finding.Severity == lintSeverityError {
+			errors = append(errors, fmt.Sprintf("%s: %s", finding.Check, finding.Message))
+		}
+	}
+
+	if len(errors) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("lint failed, %d errors (skip with skipLint):\n%s",
+		len(errors), strings.Join(errors, "\n"))
+}
+
+// Lint runs bootc container lint and checks the image as publish would push
+// it, with the signing config and committed, for content in /var, stray files
+// in /run and /tmp, a kernel with an initramfs and /usr/etc files shadowed by
+// /etc. Findings are returned, not an error, publish fails on error findings
+func (a *Atomic) Lint(
+	ctx context.Context,
+	// registry url, e.g. ghcr.io
+	imageRegistry string,
+	// name of the image
+	imageName string,
+	// repository name the signing policy also requires signatures for, if
+	// different from imageName
+	// +optional
+	repository *string,
+	// registry username
+	// also used as the registry namespace
+	// +optional
+	username string,
+	// additional tags to publish in addition to the default tags
+	// +optional
+	additionalTags []string,
+	// skip opinionated ublue-way of setting up signing config
+	// +optional
+	// +default=false
+	skipSigningConfig bool,
+	// public keys accepted by the signing config, defaults to cosign.pub of
+	// the source
+	// +optional
+	signingPublicKeys []*dagger.File,
+	// signed identity required by the signing policy: matchRepository,
+	// matchExact or remapIdentity
+	// +optional
+	// +default="matchRepository"
+	signedIdentity string,
+	// remapIdentity prefix images are also pulled from
+	// +optional
+	signedIdentityPrefix string,
+	// skip namespacing registry with username
+	// +optional
+	// +default=false
+	skipRegistryNamespace bool,
+	// skip adding default tags
+	// +optional
+	// +default=false
+	skipDefaultTags bool,
+) ([]*LintFinding, error) {
+	ctr, _, err := a.fedoraAtomic(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	primary := &Destination{Registry: imageRegistry, Username: username}
+	if !skipRegistryNamespace {
+		primary.Namespace = username
+	}
+
+	tags := slices.Clone(additionalTags)
+	if !skipDefaultTags {
+		tags = append(tags, a.Tags...)
+	}
+
+	destinationRefs, err := publishedRefs(
+		append([]*Destination{primary}, a.Destinations...),
+		imageName,
+		tags,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ctr, err = a.publishedImage(
+		ctx,
+		ctr,
+		slices.Concat(destinationRefs...),
+		primary.prefix(),
+		imageName,
+		repository,
+		skipSigningConfig,
+		signingPublicKeys,
+		signedIdentity,
+		signedIdentityPrefix,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return lint(ctx, ctr)
+}
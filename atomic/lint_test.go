@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBootcFindings(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		exitCode   int
+		stdout     string
+		stderr     string
+		severities []string
+	}{
+		{
+			name:       "passed",
+			stdout:     "Checks passed: 9\n",
+			severities: []string{},
+		},
+		{
+			name:       "warnings",
+			stdout:     "Lint warning: var-log: Found non-empty logfile: /var/log/dnf.log\nChecks passed: 8\n",
+			severities: []string{lintSeverityWarning},
+		},
+		{
+			name:       "failed",
+			exitCode:   1,
+			stderr:     "error: Linting: etc-usretc: Found /usr/etc - this is a bootc implementation detail\n",
+			severities: []string{lintSeverityError},
+		},
+		{
+			name:       "not installed",
+			exitCode:   127,
+			stderr:     "bash: line 1: bootc: command not found\n",
+			severities: []string{lintSeverityWarning},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			findings := bootcFindings(tt.exitCode, tt.stdout, tt.stderr)
+			if len(findings) != len(tt.severities) {
+				t.Fatalf("bootcFindings() = %d findings, want %d", len(findings), len(tt.severities))
+			}
+
+			for i, finding := range findings {
+				if finding.Severity != tt.severities[i] {
+					t.Errorf("finding %d severity = %s, want %s", i, finding.Severity, tt.severities[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPathFindings(t *testing.T) {
+	t.Parallel()
+
+	if findings := pathFindings("var", lintSeverityWarning, "content in /var", "\n"); len(findings) != 0 {
+		t.Errorf("pathFindings() of no paths = %v, want none", findings)
+	}
+
+	listing := strings.Repeat("/var/lib/foo\n", lintMaxPaths+1)
+	findings := pathFindings("var", lintSeverityWarning, "content in /var", listing)
+	if len(findings) != 1 {
+		t.Fatalf("pathFindings() = %d findings, want 1", len(findings))
+	}
+	if len(findings[0].Paths) != lintMaxPaths || !strings.HasSuffix(findings[0].Message, "(21 paths)") {
+		t.Errorf("pathFindings() = %+v", findings[0])
+	}
+}
+
+func TestKernelFindings(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		listing string
+		want    int
+	}{
+		{
+			name:    "kernel and initramfs",
+			listing: "/usr/lib/modules/6.17.1-300.fc43.x86_64/initramfs.img\n/usr/lib/modules/6.17.1-300.fc43.x86_64/vmlinuz\n",
+		},
+		{
+			name:    "no kernel",
+			listing: "",
+			want:    1,
+		},
+		{
+			name:    "no initramfs",
+			listing: "/usr/lib/modules/6.17.1-300.fc43.x86_64/vmlinuz\n",
+			want:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			findings := kernelFindings(tt.listing)
+			if len(findings) != tt.want {
+				t.Fatalf("kernelFindings() = %d findings, want %d", len(findings), tt.want)
+			}
+
+			for _, finding := range findings {
+				if finding.Severity != lintSeverityError {
+					t.Errorf("finding severity = %s, want %s", finding.Severity, lintSeverityError)
+				}
+			}
+		})
+	}
+}
+
+func TestLintError(t *testing.T) {
+	t.Parallel()
+
+	if err := lintError([]*LintFinding{{Check: "var", Severity: lintSeverityWarning}}); err != nil {
+		t.Errorf("lintError() of warnings = %v, want nil", err)
+	}
+
+	err := lintError([]*LintFinding{
+		{Check: "var", Severity: lintSeverityWarning},
+		{Check: "kernel", Severity: lintSeverityError, Message: "no kernel found in /usr/lib/modules"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "kernel: no kernel found in /usr/lib/modules") {
+		t.Errorf("lintError() = %v", err)
+	}
+}
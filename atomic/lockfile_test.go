@@ -0,0 +1,240 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseRPMPackages(t *testing.T) {
+	t.Parallel()
+
+	out := "fish\t0\t3.7.1\t5.fc43\tx86_64\tabc\t1760000200\n" +
+		"gpg-pubkey\t0\tdeadbeef\t1\t(none)\t(none)\t1760000100\n" +
+		"\n" +
+		"shim-x64\t1\t15.8\t3\tx86_64\t(none)\t1760000100\n"
+
+	got, err := parseRPMPackages(out)
+	if err != nil {
+		t.Fatalf("parseRPMPackages() unexpected error: %v", err)
+	}
+
+	want := []lockedPackage{
+		{Name: "fish", Epoch: "0", Version: "3.7.1", Release: "5.fc43", Arch: "x86_64", Checksum: "abc", InstallTID: 1760000200},
+		{Name: "shim-x64", Epoch: "1", Version: "15.8", Release: "3", Arch: "x86_64", InstallTID: 1760000100},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("parseRPMPackages() = %v, want %v", got, want)
+	}
+
+	if got := got[0].nevra(); got != "fish-3.7.1-5.fc43.x86_64" {
+		t.Fatalf("nevra() = %q, want %q", got, "fish-3.7.1-5.fc43.x86_64")
+	}
+	if got := got[1].nevra(); got != "shim-x64-1:15.8-3.x86_64" {
+		t.Fatalf("nevra() = %q, want %q", got, "shim-x64-1:15.8-3.x86_64")
+	}
+	for _, p := range got {
+		if name := nevraName(p.nevra()); name != p.Name {
+			t.Fatalf("nevraName(%q) = %q, want %q", p.nevra(), name, p.Name)
+		}
+	}
+
+	if _, err := parseRPMPackages("fish\t0\t3.7.1\n"); err == nil {
+		t.Fatal("parseRPMPackages() expected an error for a short line")
+	}
+}
+
+func TestChangedPackages(t *testing.T) {
+	t.Parallel()
+
+	base := []lockedPackage{
+		{Name: "bash", Epoch: "0", Version: "5.2", Release: "1", Arch: "x86_64"},
+		{Name: "gtk3", Epoch: "0", Version: "3.24", Release: "1", Arch: "x86_64"},
+	}
+	built := []lockedPackage{
+		{Name: "gtk3", Epoch: "0", Version: "3.24", Release: "2", Arch: "x86_64"},
+		{Name: "fish", Epoch: "0", Version: "3.7.1", Release: "5", Arch: "x86_64"},
+		{Name: "bash", Epoch: "0", Version: "5.2", Release: "1", Arch: "x86_64"},
+	}
+
+	got := changedPackages(base, built)
+	want := []lockedPackage{built[1], built[0]}
+	if !slices.Equal(got, want) {
+		t.Fatalf("changedPackages() = %v, want %v", got, want)
+	}
+}
+
+func TestLockDrift(t *testing.T) {
+	t.Parallel()
+
+	fish := lockedPackage{Name: "fish", Epoch: "0", Version: "3.7.1", Release: "5", Arch: "x86_64", Checksum: "abc"}
+	niri := lockedPackage{Name: "niri", Epoch: "0", Version: "25.08", Release: "1", Arch: "x86_64"}
+
+	newer := fish
+	newer.Release = "6"
+	rebuilt := fish
+	rebuilt.Checksum = "def"
+	extra := lockedPackage{Name: "zsh", Epoch: "0", Version: "5.9", Release: "1", Arch: "x86_64"}
+
+	tests := []struct {
+		name      string
+		installed []lockedPackage
+		want      []string
+	}{
+		{
+			name:      "no drift",
+			installed: []lockedPackage{niri, fish},
+			want:      []string{},
+		},
+		{
+			name:      "different version",
+			installed: []lockedPackage{newer, niri},
+			want:      []string{"fish.x86_64: locked 3.7.1-5, installed 3.7.1-6"},
+		},
+		{
+			name:      "different checksum",
+			installed: []lockedPackage{rebuilt, niri},
+			want:      []string{"fish.x86_64: checksum def does not match locked abc"},
+		},
+		{
+			name:      "missing and unexpected packages",
+			installed: []lockedPackage{fish, extra},
+			want: []string{
+				"niri.x86_64: locked 25.08-1, not installed",
+				"zsh.x86_64: installed 5.9-1, not locked",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := lockDrift([]lockedPackage{fish, niri}, tt.installed)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("lockDrift() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLockfile(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "valid lockfile",
+			data: `{"version": 1, "variant": "niri", "suffix": "main", "releaseVersion": "43",
+"arch": "x86_64", "baseImage": "quay.io/fedora-ostree-desktops/silverblue:43",
+"packages": [{"name": "niri", "epoch": "0", "version": "25.08", "release": "1",
+"arch": "x86_64", "repo": "copr:copr.fedorainfracloud.org:yalter:niri", "checksum": "abc"}]}`,
+		},
+		{
+			name:    "unsupported version",
+			data:    `{"version": 2}`,
+			wantErr: "silverblue.lock.json: unsupported lockfile version 2 (expected 1)",
+		},
+		{
+			name:    "unknown field",
+			data:    `{"version": 1, "pakages": []}`,
+			wantErr: "silverblue.lock.json: unable to parse lockfile: json: unknown field \"pakages\"",
+		},
+		{
+			name:    "incomplete package",
+			data:    `{"version": 1, "packages": [{"name": "niri"}]}`,
+			wantErr: "silverblue.lock.json: package 1 must have a name, version, release and arch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parseLockfile("silverblue.lock.json", []byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseLockfile() unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("parseLockfile() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLockedBuildDrift(t *testing.T) {
+	t.Parallel()
+
+	// base image, package transaction and script install transaction IDs
+	bash := lockedPackage{Name: "bash", Epoch: "0", Version: "5.2", Release: "1", Arch: "x86_64", InstallTID: 100}
+	fish := lockedPackage{Name: "fish", Epoch: "0", Version: "3.7.1", Release: "5", Arch: "x86_64", InstallTID: 200}
+	gtk3 := lockedPackage{Name: "gtk3", Epoch: "0", Version: "3.24", Release: "2", Arch: "x86_64", InstallTID: 200}
+	less := lockedPackage{Name: "less", Epoch: "0", Version: "668", Release: "1", Arch: "x86_64", InstallTID: 200}
+	onePassword := lockedPackage{Name: "1password", Epoch: "0", Version: "8.11.8", Release: "1", Arch: "x86_64", InstallTID: 300}
+	upgraded := fish
+	upgraded.Release = "6"
+	upgraded.InstallTID = 300
+	stale := fish
+	stale.Release = "4"
+	stale.InstallTID = 100
+
+	plan := &buildPlan{
+		PackagesInstalled: plannedItems{{Name: "fish"}, {Name: "gtk3"}},
+		Scripts:           plannedItems{{Name: "1Password.sh"}},
+	}
+	lock := &lockfile{Packages: []lockedPackage{fish, gtk3}}
+	lockPlan(plan, lock, "atomic/locks/silverblue-main-43-x86_64.lock.json")
+
+	// the package transaction is the locked plan without its scripts
+	if transaction := withoutScripts(plan); len(transaction.Scripts) != 0 ||
+		!slices.Equal(transaction.PackagesInstalled.names(), []string{"fish-3.7.1-5.x86_64", "gtk3-3.24-2.x86_64"}) {
+		t.Fatalf("withoutScripts() = %+v", transaction)
+	}
+	if len(plan.Scripts) != 1 {
+		t.Fatalf("withoutScripts() changed the scripts of the plan: %v", plan.Scripts)
+	}
+
+	tests := []struct {
+		name  string
+		built []lockedPackage
+		want  []string
+	}{
+		{
+			name:  "script installs a package",
+			built: []lockedPackage{bash, fish, gtk3, onePassword},
+			want:  []string{},
+		},
+		{
+			name:  "script changes a locked package",
+			built: []lockedPackage{bash, upgraded, gtk3, onePassword},
+			want:  []string{"fish.x86_64: locked 3.7.1-5, changed by a script to 3.7.1-6"},
+		},
+		{
+			name:  "transaction installs an unlocked package",
+			built: []lockedPackage{bash, fish, gtk3, less, onePassword},
+			want:  []string{"less.x86_64: installed 668-1, not locked"},
+		},
+		{
+			name:  "locked package not installed",
+			built: []lockedPackage{bash, stale, gtk3},
+			want:  []string{"fish.x86_64: locked 3.7.1-5, installed 3.7.1-4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := lockedBuildDrift(lock.Packages, tt.built)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("lockedBuildDrift() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
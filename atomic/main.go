@@ -55,6 +55,16 @@ func New(
 	// +optional
 	// +default=false
 	skipDefaultLabels bool,
+	// Package manifest path relative to source, extends or overrides the
+	// built-in package sets if present (see manifest.go)
+	// +optional
+	// +default="atomic/packages.yaml"
+	manifest string,
+	// Install exactly the package versions of the lockfile and fail on
+	// drift, see Atomic.Lock
+	// +optional
+	// +default=false
+	locked bool,
 ) (*Atomic, error) {
 	sourceFiles, err := source.Glob(ctx, "*")
 	if err != nil {
@@ -77,6 +87,8 @@ func New(
 		Suffix:            suffix,
 		Labels:            additionalLabels,
 		SkipDefaultLabels: skipDefaultLabels,
+		Manifest:          manifest,
+		Locked:            locked,
 	}
 
 	return a, nil
@@ -97,22 +109,36 @@ type Atomic struct {
 
 	// Generated atomic container image
 	Digests []string
-	Labels  []string
+	// Digest reference of the published image, e.g. ghcr.io/foo/bar@sha256:...
+	Digest string
+	// References the published image was tagged as
+	PublishedRefs []string
+	// Published image per destination, the publish arguments first
+	Published []*PublishedDestination
+	// Registries published to in addition to the publish arguments, see
+	// Atomic.WithDestination
+	Destinations []*Destination
+	// SBOM of the published image, see Atomic.Sbom
+	PublishedSbom *dagger.Directory
+	Labels        []string
 	// MajorVersion *string
 	// Date string
 	Tags           []string
 	ReleaseVersion string
+	// rpm architecture, e.g. x86_64
+	Arch string
+
+	// Package manifest path relative to Source
+	Manifest string
 
 	// Flags
 	SkipDefaultLabels bool
+	Locked            bool
 }
 
 // Container returns a Fedora Atomic container as a dagger.Container object
 func (a *Atomic) Container(ctx context.Context) (*dagger.Container, error) {
-	fedora, err := a.fedoraAtomic(ctx)
-	if err != nil {
-		return nil, err
-	}
+	ctr, _, err := a.fedoraAtomic(ctx)
 
-	return fedora.Container(), nil
+	return ctr, err
 }
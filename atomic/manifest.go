@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// manifestVersion is the latest package manifest schema version, version
+	// 1 (two-level selector maps) is still accepted
+	manifestVersion = 2
+
+	manifestModeExtend   = "extend"
+	manifestModeOverride = "override"
+)
+
+var (
+	// manifestSelectors are the well-known version 1 selector keys, release
+	// versions (e.g. 43) are also accepted
+	manifestSelectors = []string{All, Main, Niri, Nvidia, Silverblue}
+
+	releaseVersionSelector = regexp.MustCompile(`^[0-9]+$`)
+
+	// manifestSections maps the manifest sections to the key holding the
+	// items of a version 2 rule
+	manifestSections = map[string]string{
+		"reposForBuild":     "repos",
+		"reposForImage":     "repos",
+		"packagesInstalled": "packages",
+		"packagesRemoved":   "packages",
+		"scripts":           "scripts",
+	}
+)
+
+// packageSet is the collection of repos, packages and scripts applied to the
+// image
+type packageSet struct {
+	ReposForBuild     []rule
+	ReposForImage     []rule
+	PackagesInstalled []rule
+	PackagesRemoved   []rule
+	Scripts           []rule
+}
+
+// defaultPackageSet returns the built-in package set
+func defaultPackageSet() *packageSet {
+	return &packageSet{
+		ReposForBuild:     reposForBuild,
+		ReposForImage:     reposForImage,
+		PackagesInstalled: packagesInstalled,
+		PackagesRemoved:   packagesRemoved,
+		Scripts:           scriptsPostPackageInstall,
+	}
+}
+
+// manifest is a declarative package manifest, e.g. atomic/packages.yaml
+//
+//	version: 2
+//	mode: extend # or override
+//	reposForBuild:
+//	  - https://... # always applied
+//	  - when: variant == niri
+//	    repos: [https://...]
+//	packagesInstalled:
+//	  - when: variant == niri && version >= 43
+//	    repo: copr:yalter/niri # optional, see repoID
+//	    packages: [niri]
+//	packagesRemoved:
+//	  - opensc
+//	scripts:
+//	  - Zed.sh
+//
+// Version 1 manifests use two-level selector maps for packages instead,
+// e.g. {niri: {all: [niri]}}, and plain lists for repos.
+//
+// Sections missing from the manifest always fall back to the built-in
+// defaults. In extend mode the sections present are appended to the defaults,
+// in override mode they replace them.
+type manifest struct {
+	Version           int
+	Mode              string
+	ReposForBuild     []rule
+	ReposForImage     []rule
+	PackagesInstalled []rule
+	PackagesRemoved   []rule
+	Scripts           []rule
+}
+
+// manifestError is a manifest parsing or validation error
+type manifestError struct {
+	Path   string
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *manifestError) Error() string {
+	if e.Line <= 0 {
+		return fmt.Sprintf("%s: %s", e.Path, e.Msg)
+	}
+
+	return fmt.Sprintf("%s:%d:%d: %s", e.Path, e.Line, e.Column, e.Msg)
+}
+
+// packageSet returns the package set for the image, the built-in defaults
+// extended or overridden by the manifest if present in the source directory
+func (a *Atomic) packageSet(ctx context.Context) (*packageSet, error) {
+	set := defaultPackageSet()
+	if a.Manifest == "" {
+		return set, nil
+	}
+
+	matches, err := a.Source.Glob(ctx, a.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read source files: %w", err)
+	}
+
+	if len(matches) == 0 {
+		return set, nil
+	}
+
+	contents, err := a.Source.File(a.Manifest).Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read manifest %s: %w", a.Manifest, err)
+	}
+
+	m, err := parseManifest(a.Manifest, []byte(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	return m.apply(set), nil
+}
+
+// parseManifest parses and validates the given manifest contents, path is
+// only used for error messages
+func parseManifest(path string, data []byte) (*manifest, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, &manifestError{Path: path, Msg: err.Error()}
+	}
+
+	if len(root.Content) == 0 {
+		return nil, &manifestError{Path: path, Msg: "empty manifest"}
+	}
+
+	p := manifestParser{path: path}
+	doc := root.Content[0]
+	if err := p.expectKind(doc, yaml.MappingNode, "manifest"); err != nil {
+		return nil, err
+	}
+
+	// the version decides how the sections are parsed, collect them first
+	keys := map[string]*yaml.Node{}
+	values := map[string]*yaml.Node{}
+	for i := 0; i < len(doc.Content); i += 2 {
+		key, value := doc.Content[i], doc.Content[i+1]
+		if _, ok := keys[key.Value]; ok {
+			return nil, p.errorf(key, "duplicate key %q", key.Value)
+		}
+
+		_, section := manifestSections[key.Value]
+		if !section && key.Value != "version" && key.Value != "mode" {
+			return nil, p.errorf(key, "unknown key %q", key.Value)
+		}
+
+		keys[key.Value] = key
+		values[key.Value] = value
+	}
+
+	m := &manifest{Mode: manifestModeExtend}
+
+	version, ok := values["version"]
+	if !ok {
+		return nil, p.errorf(doc, "missing required key \"version\"")
+	}
+	if err := version.Decode(&m.Version); err != nil || version.Kind != yaml.ScalarNode {
+		return nil, p.errorf(version, "version must be an integer")
+	}
+	if m.Version < 1 || m.Version > manifestVersion {
+		return nil, p.errorf(version, "unsupported manifest version %d (expected 1 to %d)",
+			m.Version, manifestVersion)
+	}
+
+	if mode, ok := values["mode"]; ok {
+		var err error
+		m.Mode, err = p.scalar(mode, "mode")
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains([]string{manifestModeExtend, manifestModeOverride}, m.Mode) {
+			return nil, p.errorf(mode, "unknown mode %q (expected %s or %s)",
+				m.Mode, manifestModeExtend, manifestModeOverride)
+		}
+	}
+
+	sections := []struct {
+		name string
+		dest *[]rule
+	}{
+		{"reposForBuild", &m.ReposForBuild},
+		{"reposForImage", &m.ReposForImage},
+		{"packagesInstalled", &m.PackagesInstalled},
+		{"packagesRemoved", &m.PackagesRemoved},
+		{"scripts", &m.Scripts},
+	}
+	for _, section := range sections {
+		name, dest := section.name, section.dest
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+
+		var err error
+		switch {
+		case m.Version >= 2:
+			*dest, err = p.rules(value, name, manifestSections[name])
+		case name == "scripts":
+			err = p.errorf(keys[name], "%s requires manifest version 2", name)
+		case name == "packagesInstalled" || name == "packagesRemoved":
+			*dest, err = p.packages(value, name)
+		default:
+			var items []string
+			items, err = p.strings(value, name)
+			*dest = []rule{{Items: items, Origin: p.origin(value)}}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// apply returns a new package set with the manifest applied to the given set
+func (m *manifest) apply(set *packageSet) *packageSet {
+	override := m.Mode == manifestModeOverride
+
+	return &packageSet{
+		ReposForBuild:     applyRules(set.ReposForBuild, m.ReposForBuild, override),
+		ReposForImage:     applyRules(set.ReposForImage, m.ReposForImage, override),
+		PackagesInstalled: applyRules(set.PackagesInstalled, m.PackagesInstalled, override),
+		PackagesRemoved:   applyRules(set.PackagesRemoved, m.PackagesRemoved, override),
+		Scripts:           applyRules(set.Scripts, m.Scripts, override),
+	}
+}
+
+// applyRules extends (or overrides) base with the rules from the manifest,
+// nil values means the section was not present in the manifest
+func applyRules(base []rule, values []rule, override bool) []rule {
+	if values == nil {
+		return base
+	}
+
+	if override {
+		return values
+	}
+
+	return append(slices.Clone(base), values...)
+}
+
+// manifestParser walks the manifest yaml nodes reporting errors with the
+// location of the offending node
+type manifestParser struct {
+	path string
+}
+
+func (p manifestParser) errorf(node *yaml.Node, format string, args ...any) error {
+	return &manifestError{
+		Path:   p.path,
+		Line:   node.Line,
+		Column: node.Column,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+// origin returns the location of the given node, used to annotate rules
+func (p manifestParser) origin(node *yaml.Node) string {
+	return fmt.Sprintf("%s:%d", p.path, node.Line)
+}
+
+func (p manifestParser) expectKind(node *yaml.Node, kind yaml.Kind, name string) error {
+	if node.Kind == kind {
+		return nil
+	}
+
+	expected := map[yaml.Kind]string{
+		yaml.MappingNode:  "a mapping",
+		yaml.SequenceNode: "a list",
+		yaml.ScalarNode:   "a string",
+	}[kind]
+
+	return p.errorf(node, "%s must be %s", name, expected)
+}
+
+func (p manifestParser) scalar(node *yaml.Node, name string) (string, error) {
+	if err := p.expectKind(node, yaml.ScalarNode, name); err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(node.Value) == "" {
+		return "", p.errorf(node, "%s must not be empty", name)
+	}
+
+	return node.Value, nil
+}
+
+func (p manifestParser) strings(node *yaml.Node, name string) ([]string, error) {
+	if err := p.expectKind(node, yaml.SequenceNode, name); err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for _, n := range node.Content {
+		v, err := p.scalar(n, fmt.Sprintf("%s entry", name))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+
+	return result, nil
+}
+
+// selector validates a package selector key, one of manifestSelectors or a
+// release version
+func (p manifestParser) selector(node *yaml.Node, name string) (string, error) {
+	v, err := p.scalar(node, name)
+	if err != nil {
+		return "", err
+	}
+
+	if !slices.Contains(manifestSelectors, v) && !releaseVersionSelector.MatchString(v) {
+		return "", p.errorf(node,
+			"unknown selector %q in %s (expected a release version or one of: %s)",
+			v, name, strings.Join(manifestSelectors, ", "),
+		)
+	}
+
+	return v, nil
+}
+
+// packages parses a version 1 two level selector map of package lists into
+// rules, sorted by selector:
+//
+//	<selector>:
+//	  <selector>: [package, ...]
+func (p manifestParser) packages(node *yaml.Node, name string) ([]rule, error) {
+	if err := p.expectKind(node, yaml.MappingNode, name); err != nil {
+		return nil, err
+	}
+
+	result := map[string]map[string][]string{}
+	origins := map[string]map[string]string{}
+	for i := 0; i < len(node.Content); i += 2 {
+		one, err := p.selector(node.Content[i], name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := result[one]; ok {
+			return nil, p.errorf(node.Content[i], "duplicate selector %q in %s", one, name)
+		}
+
+		inner := node.Content[i+1]
+		innerName := fmt.Sprintf("%s.%s", name, one)
+		if err := p.expectKind(inner, yaml.MappingNode, innerName); err != nil {
+			return nil, err
+		}
+
+		result[one] = map[string][]string{}
+		origins[one] = map[string]string{}
+		for j := 0; j < len(inner.Content); j += 2 {
+			two, err := p.selector(inner.Content[j], innerName)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := result[one][two]; ok {
+				return nil, p.errorf(inner.Content[j],
+					"duplicate selector %q in %s", two, innerName)
+			}
+
+			result[one][two], err = p.strings(
+				inner.Content[j+1],
+				fmt.Sprintf("%s.%s", innerName, two),
+			)
+			if err != nil {
+				return nil, err
+			}
+			origins[one][two] = p.origin(inner.Content[j])
+		}
+	}
+
+	rules := []rule{}
+	for _, one := range slices.Sorted(maps.Keys(result)) {
+		for _, two := range slices.Sorted(maps.Keys(result[one])) {
+			rules = append(rules, rule{
+				When:   selectorFromPair(one, two),
+				Items:  result[one][two],
+				Origin: origins[one][two],
+			})
+		}
+	}
+
+	return rules, nil
+}
+
+// rules parses a version 2 list of rules, each entry either a plain item
+// (always applied) or a mapping:
+//
+//   - when: <selector>
+//     <itemsKey>: [item, ...]
+func (p manifestParser) rules(node *yaml.Node, name string, itemsKey string) ([]rule, error) {
+	if err := p.expectKind(node, yaml.SequenceNode, name); err != nil {
+		return nil, err
+	}
+
+	rules := []rule{}
+	for _, entry := range node.Content {
+		if entry.Kind == yaml.ScalarNode {
+			item, err := p.scalar(entry, fmt.Sprintf("%s entry", name))
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule{Items: []string{item}, Origin: p.origin(entry)})
+			continue
+		}
+
+		if err := p.expectKind(entry, yaml.MappingNode, fmt.Sprintf("%s entry", name)); err != nil {
+			return nil, err
+		}
+
+		r := rule{Origin: p.origin(entry)}
+		seen := map[string]bool{}
+		for i := 0; i < len(entry.Content); i += 2 {
+			key, value := entry.Content[i], entry.Content[i+1]
+			if seen[key.Value] {
+				return nil, p.errorf(key, "duplicate key %q in %s entry", key.Value, name)
+			}
+			seen[key.Value] = true
+
+			var err error
+			switch {
+			case key.Value == "when":
+				r.When, err = p.selectorExpr(value, name)
+			case key.Value == "repo" && itemsKey == "packages":
+				r.Repo, err = p.scalar(value, fmt.Sprintf("%s repo", name))
+			case key.Value == itemsKey:
+				r.Items, err = p.strings(value, fmt.Sprintf("%s.%s", name, itemsKey))
+			default:
+				expected := "when"
+				if itemsKey == "packages" {
+					expected += ", repo"
+				}
+				err = p.errorf(key, "unknown key %q in %s entry (expected %s or %s)",
+					key.Value, name, expected, itemsKey)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !seen[itemsKey] {
+			return nil, p.errorf(entry, "%s entry is missing %q", name, itemsKey)
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// selectorExpr validates a version 2 selector expression
+func (p manifestParser) selectorExpr(node *yaml.Node, name string) (string, error) {
+	if err := p.expectKind(node, yaml.ScalarNode, fmt.Sprintf("%s when", name)); err != nil {
+		return "", err
+	}
+
+	if _, err := parseSelector(node.Value); err != nil {
+		return "", p.errorf(node, "%s", err)
+	}
+
+	return node.Value, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "valid version 1 manifest",
+			data: `version: 1
+mode: override
+reposForBuild:
+  - https://example.com/example.repo
+packagesInstalled:
+  niri:
+    "43":
+      - niri
+`,
+		},
+		{
+			name: "valid version 2 manifest",
+			data: `version: 2
+reposForBuild:
+  - https://example.com/example.repo
+  - when: variant == niri
+    repos: [https://example.com/niri.repo]
+packagesInstalled:
+  - when: variant == niri && version >= 43 && !nvidia
+    packages: [niri]
+scripts:
+  - Zed.sh
+`,
+		},
+		{
+			name:    "missing version",
+			data:    "mode: extend\n",
+			wantErr: "packages.yaml:1:1: missing required key \"version\"",
+		},
+		{
+			name:    "unsupported version",
+			data:    "version: 3\n",
+			wantErr: "packages.yaml:1:10: unsupported manifest version 3 (expected 1 to 2)",
+		},
+		{
+			name:    "scripts in version 1",
+			data:    "version: 1\nscripts: [Zed.sh]\n",
+			wantErr: "packages.yaml:2:1: scripts requires manifest version 2",
+		},
+		{
+			name: "invalid selector",
+			data: `version: 2
+packagesInstalled:
+  - when: variant >= 43
+    packages: [niri]
+`,
+			wantErr: `packages.yaml:3:11: invalid selector "variant >= 43": column 9: operator ">=" is only supported for version`,
+		},
+		{
+			name: "rule without items",
+			data: `version: 2
+reposForImage:
+  - when: all
+`,
+			wantErr: `packages.yaml:3:5: reposForImage entry is missing "repos"`,
+		},
+		{
+			name: "rule with unknown key",
+			data: `version: 2
+packagesRemoved:
+  - when: all
+    repos: [foo]
+`,
+			wantErr: `packages.yaml:4:5: unknown key "repos" in packagesRemoved entry (expected when, repo or packages)`,
+		},
+		{
+			name: "rule with duplicate when",
+			data: `version: 2
+packagesInstalled:
+  - when: variant == niri
+    when: nvidia
+    packages: [niri]
+`,
+			wantErr: `packages.yaml:4:5: duplicate key "when" in packagesInstalled entry`,
+		},
+		{
+			name: "rule with duplicate repo",
+			data: `version: 2
+packagesInstalled:
+  - repo: copr:yalter/niri
+    packages: [niri]
+    repo: fedora
+`,
+			wantErr: `packages.yaml:5:5: duplicate key "repo" in packagesInstalled entry`,
+		},
+		{
+			name:    "unknown key",
+			data:    "version: 1\npackages: []\n",
+			wantErr: "packages.yaml:2:1: unknown key \"packages\"",
+		},
+		{
+			name:    "unknown mode",
+			data:    "version: 1\nmode: replace\n",
+			wantErr: "packages.yaml:2:7: unknown mode \"replace\" (expected extend or override)",
+		},
+		{
+			name: "unknown selector",
+			data: `version: 1
+packagesInstalled:
+  silverbleu:
+    all: [fish]
+`,
+			wantErr: "packages.yaml:3:3: unknown selector \"silverbleu\" in packagesInstalled (expected a release version or one of: all, main, niri, nvidia, silverblue)",
+		},
+		{
+			name: "packages must be a list",
+			data: `version: 1
+packagesRemoved:
+  all:
+    all: opensc
+`,
+			wantErr: "packages.yaml:4:10: packagesRemoved.all.all must be a list",
+		},
+		{
+			name:    "empty repo",
+			data:    "version: 1\nreposForImage:\n  - \"\"\n",
+			wantErr: "packages.yaml:3:5: reposForImage entry must not be empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parseManifest("packages.yaml", []byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseManifest() unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("parseManifest() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManifestApply(t *testing.T) {
+	t.Parallel()
+
+	base := &packageSet{
+		ReposForBuild:     []rule{{Items: []string{"a.repo"}}},
+		ReposForImage:     []rule{{Items: []string{"b.repo"}}},
+		PackagesInstalled: []rule{{Items: []string{"fish"}}},
+		PackagesRemoved:   []rule{{Items: []string{"opensc"}}},
+	}
+
+	extended := (&manifest{
+		Mode:              manifestModeExtend,
+		PackagesInstalled: []rule{{When: "niri", Items: []string{"niri"}}},
+	}).apply(base)
+
+	if want := []rule{
+		{Items: []string{"fish"}},
+		{When: "niri", Items: []string{"niri"}},
+	}; !slices.EqualFunc(extended.PackagesInstalled, want, ruleEqual) {
+		t.Fatalf("extend PackagesInstalled = %v, want %v", extended.PackagesInstalled, want)
+	}
+	if len(base.PackagesInstalled) != 1 {
+		t.Fatalf("extend modified the base package set: %v", base.PackagesInstalled)
+	}
+
+	overridden := (&manifest{
+		Mode:            manifestModeOverride,
+		PackagesRemoved: []rule{},
+	}).apply(base)
+
+	if len(overridden.PackagesRemoved) != 0 {
+		t.Fatalf("override PackagesRemoved = %v, want empty", overridden.PackagesRemoved)
+	}
+	if want := base.ReposForImage; !slices.EqualFunc(overridden.ReposForImage, want, ruleEqual) {
+		t.Fatalf("override ReposForImage = %v, want %v (defaults for missing sections)", overridden.ReposForImage, want)
+	}
+}
+
+func TestParseManifestVersion1Selectors(t *testing.T) {
+	t.Parallel()
+
+	m, err := parseManifest("packages.yaml", []byte(`version: 1
+packagesInstalled:
+  silverblue:
+    nvidia: [foo]
+  all:
+    all: [bar]
+`))
+	if err != nil {
+		t.Fatalf("parseManifest() unexpected error: %v", err)
+	}
+
+	want := []rule{
+		{Items: []string{"bar"}},
+		{When: "silverblue && nvidia", Items: []string{"foo"}},
+	}
+	if !slices.EqualFunc(m.PackagesInstalled, want, ruleEqual) {
+		t.Fatalf("PackagesInstalled = %v, want %v", m.PackagesInstalled, want)
+	}
+
+	origins := []string{"packages.yaml:6", "packages.yaml:4"}
+	for i, r := range m.PackagesInstalled {
+		if r.Origin != origins[i] {
+			t.Fatalf("PackagesInstalled[%d].Origin = %q, want %q", i, r.Origin, origins[i])
+		}
+	}
+}
+
+func ruleEqual(a, b rule) bool {
+	return a.When == b.When && slices.Equal(a.Items, b.Items)
+}
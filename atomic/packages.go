@@ -1,31 +1,53 @@
 package main
 
-func (a *Atomic) getPackageListFrom(packageMap map[string]map[string][]string) []string {
-	packages := []string{}
+import "fmt"
+
+// rule is a list of items (packages, repos, scripts) applied when its
+// selector matches the image being built, see selector.go
+type rule struct {
+	// When is the selector expression, empty always matches
+	When  string
+	Items []string
+	// Repo is the repo the packages of the rule come from if not Fedora,
+	// see repoID, e.g. copr:yalter/niri
+	Repo string
+	// Origin is where the rule is defined if not built-in, e.g. manifest:line
+	Origin string
+}
+
+// selectorEnv returns the environment rule selectors are evaluated against
+func (a *Atomic) selectorEnv() selectorEnv {
 	suffix := Main
 	if a.Suffix != nil {
 		suffix = *a.Suffix
 	}
 
-	for _, opts := range sliceStringProduct([]string{All, a.Variant, suffix, a.ReleaseVersion}) {
-		p, ok := packageMap[opts[0]][opts[1]]
-		if ok {
-			packages = append(packages, p...)
-		}
+	return selectorEnv{
+		Variant: a.Variant,
+		Suffix:  suffix,
+		Version: a.ReleaseVersion,
+		Arch:    a.Arch,
 	}
-
-	return packages
 }
 
-func sliceStringProduct(ss []string) [][]string {
-	r := [][]string{}
-	for _, one := range ss {
-		for _, two := range ss {
-			r = append(r, []string{one, two})
+// selectorFromPair converts a selector pair from the original two-level
+// package maps, e.g. {silverblue: {nvidia: [...]}}, into a selector expression
+func selectorFromPair(one, two string) string {
+	words := []string{}
+	for _, w := range []string{one, two} {
+		if w != All {
+			words = append(words, w)
 		}
 	}
 
-	return r
+	switch len(words) {
+	case 0:
+		return ""
+	case 1:
+		return words[0]
+	}
+
+	return fmt.Sprintf("%s && %s", words[0], words[1])
 }
 
 const (
@@ -37,26 +59,37 @@ const (
 )
 
 var (
-	reposForBuild = []string{ // will not be kept in final image
-		"https://pkgs.tailscale.com/stable/fedora/tailscale.repo",
-		"https://copr.fedorainfracloud.org/coprs/yalter/niri/repo/fedora-FEDORA_MAJOR_VERSION/yalter-niri-fedora-FEDORA_MAJOR_VERSION.repo",
-		"https://copr.fedorainfracloud.org/coprs/scottames/awww/repo/fedora-FEDORA_MAJOR_VERSION/scottames-awww-fedora-FEDORA_MAJOR_VERSION.repo",
-		"https://copr.fedorainfracloud.org/coprs/scottames/ghostty/repo/fedora-FEDORA_MAJOR_VERSION/scottames-ghostty-fedora-FEDORA_MAJOR_VERSION.repo",
-		"https://copr.fedorainfracloud.org/coprs/scottames/hypr/repo/fedora-FEDORA_MAJOR_VERSION/scottames-hypr-fedora-FEDORA_MAJOR_VERSION.repo",
-		"https://copr.fedorainfracloud.org/coprs/scottames/mise/repo/fedora-FEDORA_MAJOR_VERSION/scottames-mise-fedora-FEDORA_MAJOR_VERSION.repo",
-		"https://copr.fedorainfracloud.org/coprs/scottames/vicinae/repo/fedora-FEDORA_MAJOR_VERSION/scottames-vicinae-fedora-FEDORA_MAJOR_VERSION.repo",
-		"https://copr.fedorainfracloud.org/coprs/scottames/voxtype/repo/fedora-FEDORA_MAJOR_VERSION/scottames-voxtype-fedora-FEDORA_MAJOR_VERSION.repo",
-		"https://copr.fedorainfracloud.org/coprs/scottames/zennotes/repo/fedora-FEDORA_MAJOR_VERSION/scottames-zennotes-fedora-FEDORA_MAJOR_VERSION.repo",
-		"https://copr.fedorainfracloud.org/coprs/tofik/nwg-shell/repo/fedora-FEDORA_MAJOR_VERSION/tofik-nwg-shell-fedora-FEDORA_MAJOR_VERSION.repo",
+	// will not be kept in final image, only enabled if a selected package
+	// comes from the repo (see rule.Repo and repoID)
+	reposForBuild = []rule{
+		{
+			Items: []string{
+				"https://pkgs.tailscale.com/stable/fedora/tailscale.repo",
+				"https://copr.fedorainfracloud.org/coprs/yalter/niri/repo/fedora-FEDORA_MAJOR_VERSION/yalter-niri-fedora-FEDORA_MAJOR_VERSION.repo",
+				"https://copr.fedorainfracloud.org/coprs/scottames/awww/repo/fedora-FEDORA_MAJOR_VERSION/scottames-awww-fedora-FEDORA_MAJOR_VERSION.repo",
+				"https://copr.fedorainfracloud.org/coprs/scottames/ghostty/repo/fedora-FEDORA_MAJOR_VERSION/scottames-ghostty-fedora-FEDORA_MAJOR_VERSION.repo",
+				"https://copr.fedorainfracloud.org/coprs/scottames/hypr/repo/fedora-FEDORA_MAJOR_VERSION/scottames-hypr-fedora-FEDORA_MAJOR_VERSION.repo",
+				"https://copr.fedorainfracloud.org/coprs/scottames/mise/repo/fedora-FEDORA_MAJOR_VERSION/scottames-mise-fedora-FEDORA_MAJOR_VERSION.repo",
+				"https://copr.fedorainfracloud.org/coprs/scottames/vicinae/repo/fedora-FEDORA_MAJOR_VERSION/scottames-vicinae-fedora-FEDORA_MAJOR_VERSION.repo",
+				"https://copr.fedorainfracloud.org/coprs/scottames/voxtype/repo/fedora-FEDORA_MAJOR_VERSION/scottames-voxtype-fedora-FEDORA_MAJOR_VERSION.repo",
+				"https://copr.fedorainfracloud.org/coprs/scottames/zennotes/repo/fedora-FEDORA_MAJOR_VERSION/scottames-zennotes-fedora-FEDORA_MAJOR_VERSION.repo",
+				"https://copr.fedorainfracloud.org/coprs/tofik/nwg-shell/repo/fedora-FEDORA_MAJOR_VERSION/tofik-nwg-shell-fedora-FEDORA_MAJOR_VERSION.repo",
+			},
+		},
 	}
 	// for layering, primarily because these packages do not play well with opt
-	reposForImage = []string{
-		"https://repo.vivaldi.com/stable/vivaldi-fedora.repo",
-		"https://copr.fedorainfracloud.org/coprs/scottames/zen-browser/repo/fedora-FEDORA_MAJOR_VERSION/scottames-zen-browser-fedora-FEDORA_MAJOR_VERSION.repo",
+	reposForImage = []rule{
+		{
+			Items: []string{
+				"https://repo.vivaldi.com/stable/vivaldi-fedora.repo",
+				"https://copr.fedorainfracloud.org/coprs/scottames/zen-browser/repo/fedora-FEDORA_MAJOR_VERSION/scottames-zen-browser-fedora-FEDORA_MAJOR_VERSION.repo",
+			},
+		},
 	}
-	packagesRemoved = map[string]map[string][]string{
-		Silverblue: {
-			Nvidia: {
+	packagesRemoved = []rule{
+		{
+			When: "variant == silverblue && suffix == nvidia",
+			Items: []string{
 				// https://github.com/ublue-os/hwe/blob/main/nvidia-install.sh#L29C19-L29C56
 				//  not using any applicable hardware. Extension has root-only
 				//  permission on metadata, causing errors with gext interaction
@@ -64,20 +97,19 @@ var (
 				"supergfxctl",
 			},
 		},
-		All: {
-			All: {
+		{
+			Items: []string{
 				"opensc", // breaks Yubikey
 			},
 		},
 	}
-	packagesInstalled = map[string]map[string][]string{
-		Niri: {
-			All: {
+	packagesInstalled = []rule{
+		{
+			When: "variant == niri",
+			Items: []string{
 				"gnome-keyring",
 				"grim",
 				"mako",
-				"niri",     // from copr:yalter/niri
-				"nwg-look", // from copr:tofik/nwg-shell
 				"pavucontrol",
 				"mate-polkit",
 				"rofi-wayland",
@@ -86,22 +118,40 @@ var (
 				"swaybg",
 				"swayidle",
 				"swaylock",
-				"awww", // from copr:scottames/awww
 				"waybar",
 				"wlogout",
 				"wtype",
 				"xdg-desktop-portal-gnome",
 				"xdg-desktop-portal-gtk",
-
-				// from copr:scottames/hypr
+			},
+		},
+		{
+			When:  "variant == niri",
+			Repo:  "copr:yalter/niri",
+			Items: []string{"niri"},
+		},
+		{
+			When:  "variant == niri",
+			Repo:  "copr:tofik/nwg-shell",
+			Items: []string{"nwg-look"},
+		},
+		{
+			When:  "variant == niri",
+			Repo:  "copr:scottames/awww",
+			Items: []string{"awww"},
+		},
+		{
+			When: "variant == niri",
+			Repo: "copr:scottames/hypr",
+			Items: []string{
 				"hypridle",
 				"hyprlock",
 				"hyprpaper",
 				"hyprpicker",
 			},
 		},
-		All: {
-			All: {
+		{
+			Items: []string{
 				// Installed via script
 				// "1password",
 				// "1password-cli",
@@ -112,7 +162,6 @@ var (
 				"dbus-x11",
 				"firewall-config",
 				"fish",
-				"ghostty", // from copr:scottames/ghostty
 				// https://fedoraproject.org/wiki/Changes/Modular_GnuPG_Packaging
 				"gnupg2",           // gpg executable
 				"gnupg2-dirmngr",   // certificate management service
@@ -137,7 +186,6 @@ var (
 				"libadwaita",
 				"light",
 				"lm_sensors", // required by freon gnome-ext
-				"mise",       // from copr:scottames/mise
 				"mscore-fonts-all",
 				"netcat",
 				"NetworkManager-tui",
@@ -152,17 +200,13 @@ var (
 				"powertop",
 				"pulseaudio-utils",
 				"skopeo",
-				"tailscale",
 				"udica",
-				"vicinae", // from copr:scottames/vicinae
-				"voxtype", // from copr:scottames/voxtype
 				"wl-clipboard",
 				"xclip",
 				"yubico-piv-tool-devel",
 				"yubikey-manager",
 				"yubikey-manager-qt",
 				"ydotool",
-				"zennotes",
 
 				// Qemu / Virt-manager
 				"edk2-ovmf",
@@ -174,7 +218,6 @@ var (
 				"qemu-device-display-virtio-vga",
 				"qemu-device-usb-redirect",
 				"qemu-img",
-				"qemu-system-x86-core",
 				"qemu-user-binfmt",
 				"qemu-user-static",
 				"virt-manager",
@@ -185,5 +228,38 @@ var (
 				"webkit2gtk4.1",
 			},
 		},
+		{
+			// system emulator of the native architecture, for KVM
+			When:  "arch == x86_64",
+			Items: []string{"qemu-system-x86-core"},
+		},
+		{
+			When:  "arch == aarch64",
+			Items: []string{"qemu-system-aarch64-core"},
+		},
+		{
+			Repo:  "copr:scottames/ghostty",
+			Items: []string{"ghostty"},
+		},
+		{
+			Repo:  "copr:scottames/mise",
+			Items: []string{"mise"},
+		},
+		{
+			Repo:  "tailscale",
+			Items: []string{"tailscale"},
+		},
+		{
+			Repo:  "copr:scottames/vicinae",
+			Items: []string{"vicinae"},
+		},
+		{
+			Repo:  "copr:scottames/voxtype",
+			Items: []string{"voxtype"},
+		},
+		{
+			Repo:  "copr:scottames/zennotes",
+			Items: []string{"zennotes"},
+		},
 	}
 )
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"dagger/atomic/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// builtInOrigin is the origin of rules defined in the module source
+const builtInOrigin = "built-in"
+
+// plannedItem is a resolved repo, package or script and the rule that
+// contributed it
+type plannedItem struct {
+	Name string `json:"name"`
+	// Rule is the selector of the contributing rule
+	Rule string `json:"rule"`
+	// Repo is the repo a package comes from if not Fedora
+	Repo string `json:"repo,omitempty"`
+	// Origin is where the contributing rule is defined, built-in or the
+	// manifest file and line
+	Origin string `json:"origin"`
+	// Template is the repo URL before FEDORA_MAJOR_VERSION is substituted,
+	// plans of different release versions compare repos by it
+	Template string `json:"-"`
+}
+
+type plannedItems []plannedItem
+
+// names returns the names of the planned items
+func (items plannedItems) names() []string {
+	names := []string{}
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+
+	return names
+}
+
+// templates returns the repo URLs of the planned items before the release
+// version is substituted
+func (items plannedItems) templates() []string {
+	templates := []string{}
+	for _, item := range items {
+		templates = append(templates, cmp.Or(item.Template, item.Name))
+	}
+
+	return templates
+}
+
+// packageNames returns the names of the packages, locked packages are
+// installed by NEVRA, see lockPlan
+func (items plannedItems) packageNames() []string {
+	names := []string{}
+	for _, item := range items {
+		if item.Rule == lockedOrigin {
+			names = append(names, nevraName(item.Name))
+			continue
+		}
+
+		names = append(names, item.Name)
+	}
+
+	return names
+}
+
+// buildPlan is everything fedoraAtomic will do for a given variant, suffix
+// and tag
+type buildPlan struct {
+	Variant        string `json:"variant"`
+	Suffix         string `json:"suffix"`
+	Tag            string `json:"tag"`
+	Arch           string `json:"arch"`
+	BaseImage      string `json:"baseImage"`
+	ReleaseVersion string `json:"releaseVersion"`
+
+	ReposForBuild     plannedItems `json:"reposForBuild"`
+	ReposForImage     plannedItems `json:"reposForImage"`
+	PackagesInstalled plannedItems `json:"packagesInstalled"`
+	PackagesRemoved   plannedItems `json:"packagesRemoved"`
+	Scripts           plannedItems `json:"scripts"`
+
+	Labels map[string]string `json:"labels"`
+	Tags   []string          `json:"tags"`
+}
+
+// resolvePlan resolves the rules of the given package set for the given
+// environment. Build repos are only included if needed by a selected package
+// (see rule.Repo), repos have FEDORA_MAJOR_VERSION substituted
+func resolvePlan(set *packageSet, env selectorEnv) (*buildPlan, error) {
+	plan := &buildPlan{
+		Variant:        env.Variant,
+		Suffix:         env.Suffix,
+		Arch:           env.Arch,
+		ReleaseVersion: env.Version,
+		Labels:         map[string]string{},
+		Tags:           []string{},
+	}
+
+	sections := []struct {
+		rules []rule
+		dest  *plannedItems
+	}{
+		{set.ReposForBuild, &plan.ReposForBuild},
+		{set.ReposForImage, &plan.ReposForImage},
+		{set.PackagesInstalled, &plan.PackagesInstalled},
+		{set.PackagesRemoved, &plan.PackagesRemoved},
+		{set.Scripts, &plan.Scripts},
+	}
+	for _, section := range sections {
+		items, err := resolveRules(section.rules, env)
+		if err != nil {
+			return nil, err
+		}
+		*section.dest = items
+	}
+
+	// build repos are only enabled if a selected package comes from them
+	needed := map[string]bool{}
+	for _, item := range plan.PackagesInstalled {
+		if item.Repo != "" {
+			needed[item.Repo] = true
+		}
+	}
+	plan.ReposForBuild = slices.DeleteFunc(plan.ReposForBuild, func(repo plannedItem) bool {
+		return !needed[repoID(repo.Name)]
+	})
+
+	for _, repos := range []plannedItems{plan.ReposForBuild, plan.ReposForImage} {
+		for i := range repos {
+			repos[i].Template = repos[i].Name
+			repos[i].Name = strings.ReplaceAll(
+				repos[i].Name,
+				"FEDORA_MAJOR_VERSION",
+				env.Version,
+			)
+		}
+	}
+
+	return plan, nil
+}
+
+// resolveRules returns the items of all rules matching the environment
+func resolveRules(rules []rule, env selectorEnv) (plannedItems, error) {
+	items := plannedItems{}
+	for _, r := range rules {
+		s, err := parseSelector(r.When)
+		if err != nil {
+			return nil, err
+		}
+
+		if !s.Match(env) {
+			continue
+		}
+
+		when := r.When
+		if when == "" {
+			when = All
+		}
+
+		origin := r.Origin
+		if origin == "" {
+			origin = builtInOrigin
+		}
+
+		for _, item := range r.Items {
+			items = append(items, plannedItem{
+				Name:   item,
+				Rule:   when,
+				Repo:   r.Repo,
+				Origin: origin,
+			})
+		}
+	}
+
+	return items, nil
+}
+
+// baseVariant returns the variant of the base image variant is built from
+func baseVariant(variant string) string {
+	// Niri is Silverblue-based - it should be labeled Niri,
+	//  but pulled from Silverblue
+	if variant == Niri {
+		return Silverblue
+	}
+
+	return variant
+}
+
+// planInput is everything plan looks up, through the fedora dependency or
+// the module arguments, to resolve a build plan
+type planInput struct {
+	Env selectorEnv
+	Org string
+	// Tag of the base image and Tags the image is published as
+	Tag               string
+	Tags              []string
+	BaseImage         string
+	BaseImageVersion  string
+	Labels            []string
+	SkipDefaultLabels bool
+}
+
+// planFromInput resolves the build plan of the package set for the given
+// input, see resolvePlan, and adds the tags and labels
+func planFromInput(set *packageSet, in planInput) (*buildPlan, error) {
+	plan, err := resolvePlan(set, in.Env)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Tag = in.Tag
+	plan.Tags = in.Tags
+	plan.BaseImage = in.BaseImage
+
+	plan.Labels, err = labelsFromCLI(in.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	if !in.SkipDefaultLabels {
+		defaults := defaultLabels(in.Org, in.Env.Version, in.BaseImage, in.BaseImageVersion)
+		for k, v := range defaults {
+			plan.Labels[k] = v
+		}
+	}
+
+	return plan, nil
+}
+
+// plan resolves the build plan without running any package transactions,
+// returning the base Fedora object the plan is applied to
+func (a *Atomic) plan(ctx context.Context) (*dagger.Fedora, *buildPlan, error) {
+	platform, err := a.platform(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := dagger.FedoraOpts{
+		Registry: a.Registry,
+		Org:      a.Org,
+		Tag:      a.Tag,
+		Variant:  baseVariant(a.Variant),
+	}
+
+	if a.Suffix != nil {
+		opts.Suffix = *a.Suffix
+	}
+
+	fedora := dag.Fedora(opts)
+
+	version, err := fedora.ReleaseVersion(ctx)
+	if err != nil {
+		version, err = fedora.Date(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	a.ReleaseVersion = version
+	a.Arch = archFromPlatform(platform)
+
+	a.Tags, err = fedora.DefaultTags(ctx,
+		dagger.FedoraDefaultTagsOpts{Latest: latestFedoraVersion == version},
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	set, err := a.packageSet(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	in := planInput{
+		Env:               a.selectorEnv(),
+		Org:               a.Org,
+		Tag:               a.Tag,
+		Tags:              a.Tags,
+		Labels:            a.Labels,
+		SkipDefaultLabels: a.SkipDefaultLabels,
+	}
+
+	// the base image is informational, ignore lookup errors
+	in.BaseImage, _ = fedora.BaseImage(ctx)
+	in.BaseImageVersion, _ = fedora.BaseImageVersion(ctx)
+
+	plan, err := planFromInput(set, in)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return fedora, plan, nil
+}
+
+// ResolvePlan returns the fully resolved build plan as JSON: base image,
+// repos, packages and scripts (annotated with the rule that contributed
+// them), labels and tags - without running any package transactions
+func (a *Atomic) ResolvePlan(ctx context.Context) (string, error) {
+	_, plan, err := a.plan(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("unable to encode plan: %w", err)
+	}
+
+	return string(out), nil
+}
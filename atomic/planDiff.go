@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	planDiffFormatText = "text"
+	planDiffFormatJSON = "json"
+)
+
+// planRef identifies one side of a plan diff
+type planRef struct {
+	Variant        string `json:"variant"`
+	Suffix         string `json:"suffix"`
+	Tag            string `json:"tag"`
+	ReleaseVersion string `json:"releaseVersion"`
+	BaseImage      string `json:"baseImage"`
+}
+
+func (r planRef) String() string {
+	return fmt.Sprintf("%s-%s:%s (%s)", r.Variant, r.Suffix, r.Tag, r.ReleaseVersion)
+}
+
+// listDiff is the difference between two lists of names
+type listDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+func (d listDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// labelChange is a label present on both sides with different values
+type labelChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// labelDiff is the difference between two sets of labels
+type labelDiff struct {
+	Added   map[string]string      `json:"added"`
+	Removed map[string]string      `json:"removed"`
+	Changed map[string]labelChange `json:"changed"`
+}
+
+func (d labelDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// planDiff is the difference between two build plans
+type planDiff struct {
+	From planRef `json:"from"`
+	To   planRef `json:"to"`
+
+	ReposForBuild     listDiff  `json:"reposForBuild"`
+	ReposForImage     listDiff  `json:"reposForImage"`
+	PackagesInstalled listDiff  `json:"packagesInstalled"`
+	PackagesRemoved   listDiff  `json:"packagesRemoved"`
+	Scripts           listDiff  `json:"scripts"`
+	Tags              listDiff  `json:"tags"`
+	Labels            labelDiff `json:"labels"`
+}
+
+// diffPlans returns the difference from one plan to another, repos are
+// compared before the release version is substituted
+func diffPlans(from, to *buildPlan) *planDiff {
+	ref := func(p *buildPlan) planRef {
+		return planRef{
+			Variant:        p.Variant,
+			Suffix:         p.Suffix,
+			Tag:            p.Tag,
+			ReleaseVersion: p.ReleaseVersion,
+			BaseImage:      p.BaseImage,
+		}
+	}
+
+	return &planDiff{
+		From:              ref(from),
+		To:                ref(to),
+		ReposForBuild:     diffLists(from.ReposForBuild.templates(), to.ReposForBuild.templates()),
+		ReposForImage:     diffLists(from.ReposForImage.templates(), to.ReposForImage.templates()),
+		PackagesInstalled: diffLists(from.PackagesInstalled.names(), to.PackagesInstalled.names()),
+		PackagesRemoved:   diffLists(from.PackagesRemoved.names(), to.PackagesRemoved.names()),
+		Scripts:           diffLists(from.Scripts.names(), to.Scripts.names()),
+		Tags:              diffLists(from.Tags, to.Tags),
+		Labels:            diffLabels(from.Labels, to.Labels),
+	}
+}
+
+// diffLists returns the sorted names only present in one of the lists
+func diffLists(from, to []string) listDiff {
+	d := listDiff{Added: []string{}, Removed: []string{}}
+	for _, name := range to {
+		if !slices.Contains(from, name) && !slices.Contains(d.Added, name) {
+			d.Added = append(d.Added, name)
+		}
+	}
+
+	for _, name := range from {
+		if !slices.Contains(to, name) && !slices.Contains(d.Removed, name) {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+
+	slices.Sort(d.Added)
+	slices.Sort(d.Removed)
+
+	return d
+}
+
+func diffLabels(from, to map[string]string) labelDiff {
+	d := labelDiff{
+		Added:   map[string]string{},
+		Removed: map[string]string{},
+		Changed: map[string]labelChange{},
+	}
+
+	for k, v := range to {
+		old, ok := from[k]
+		switch {
+		case !ok:
+			d.Added[k] = v
+		case old != v:
+			d.Changed[k] = labelChange{From: old, To: v}
+		}
+	}
+
+	for k, v := range from {
+		if _, ok := to[k]; !ok {
+			d.Removed[k] = v
+		}
+	}
+
+	return d
+}
+
+// String renders the diff for humans
+func (d *planDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n", d.From)
+	fmt.Fprintf(&b, "+++ %s\n", d.To)
+
+	if d.From.BaseImage != d.To.BaseImage {
+		fmt.Fprintf(&b, "\nbaseImage:\n- %s\n+ %s\n", d.From.BaseImage, d.To.BaseImage)
+	}
+
+	lists := []struct {
+		name string
+		diff listDiff
+	}{
+		{"reposForBuild", d.ReposForBuild},
+		{"reposForImage", d.ReposForImage},
+		{"packagesInstalled", d.PackagesInstalled},
+		{"packagesRemoved", d.PackagesRemoved},
+		{"scripts", d.Scripts},
+		{"tags", d.Tags},
+	}
+	changes := false
+	for _, l := range lists {
+		if l.diff.empty() {
+			continue
+		}
+
+		changes = true
+		fmt.Fprintf(&b, "\n%s:\n", l.name)
+		for _, name := range l.diff.Added {
+			fmt.Fprintf(&b, "+ %s\n", name)
+		}
+		for _, name := range l.diff.Removed {
+			fmt.Fprintf(&b, "- %s\n", name)
+		}
+	}
+
+	if !d.Labels.empty() {
+		changes = true
+		b.WriteString("\nlabels:\n")
+		for _, k := range slices.Sorted(maps.Keys(d.Labels.Added)) {
+			fmt.Fprintf(&b, "+ %s=%s\n", k, d.Labels.Added[k])
+		}
+		for _, k := range slices.Sorted(maps.Keys(d.Labels.Removed)) {
+			fmt.Fprintf(&b, "- %s=%s\n", k, d.Labels.Removed[k])
+		}
+		for _, k := range slices.Sorted(maps.Keys(d.Labels.Changed)) {
+			c := d.Labels.Changed[k]
+			fmt.Fprintf(&b, "~ %s=%s => %s\n", k, c.From, c.To)
+		}
+	}
+
+	if !changes {
+		b.WriteString("\nno differences\n")
+	}
+
+	return b.String()
+}
+
+// PlanDiff compares two build plans and reports the added and removed repos,
+// packages, scripts, tags and labels. Each side defaults to the variant,
+// suffix and tag the module was created with.
+func (a *Atomic) PlanDiff(
+	ctx context.Context,
+	// Atomic variant to compare from
+	// +optional
+	fromVariant string,
+	// Variant suffix to compare from
+	// +optional
+	fromSuffix *string,
+	// Tag or major release version to compare from
+	// +optional
+	fromTag string,
+	// Atomic variant to compare to
+	// +optional
+	toVariant string,
+	// Variant suffix to compare to
+	// +optional
+	toSuffix *string,
+	// Tag or major release version to compare to
+	// +optional
+	toTag string,
+	// Output format: text or json
+	// +optional
+	// +default="text"
+	format string,
+) (string, error) {
+	if format != planDiffFormatText && format != planDiffFormatJSON {
+		return "", fmt.Errorf("unknown format %q (expected %s or %s)",
+			format, planDiffFormatText, planDiffFormatJSON)
+	}
+
+	_, from, err := a.with(fromVariant, fromSuffix, fromTag).plan(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	_, to, err := a.with(toVariant, toSuffix, toTag).plan(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	diff := diffPlans(from, to)
+	if format == planDiffFormatText {
+		return diff.String(), nil
+	}
+
+	out, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("unable to encode plan diff: %w", err)
+	}
+
+	return string(out), nil
+}
+
+// with returns a copy of the module with the given variant, suffix and tag,
+// empty values keep the current settings
+func (a *Atomic) with(variant string, suffix *string, tag string) *Atomic {
+	other := *a
+	if variant != "" {
+		other.Variant = variant
+	}
+
+	if suffix != nil {
+		other.Suffix = suffix
+	}
+
+	if tag != "" {
+		other.Tag = tag
+	}
+
+	return &other
+}
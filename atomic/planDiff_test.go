@@ -0,0 +1,104 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiffPlans(t *testing.T) {
+	t.Parallel()
+
+	from := &buildPlan{
+		Variant:        Silverblue,
+		Suffix:         Main,
+		Tag:            "43",
+		ReleaseVersion: "43",
+		PackagesInstalled: plannedItems{
+			{Name: "fish"},
+			{Name: "opensc"},
+		},
+		Labels: map[string]string{
+			"org.opencontainers.image.version": "43",
+			"only.from":                        "yes",
+		},
+		Tags: []string{"43"},
+	}
+	to := &buildPlan{
+		Variant:        Niri,
+		Suffix:         Main,
+		Tag:            "44",
+		ReleaseVersion: "44",
+		PackagesInstalled: plannedItems{
+			{Name: "fish"},
+			{Name: "niri"},
+			{Name: "niri"},
+		},
+		Labels: map[string]string{
+			"org.opencontainers.image.version": "44",
+		},
+		Tags: []string{"44", "latest"},
+	}
+
+	diff := diffPlans(from, to)
+
+	if want := []string{"niri"}; !slices.Equal(diff.PackagesInstalled.Added, want) {
+		t.Fatalf("PackagesInstalled.Added = %v, want %v", diff.PackagesInstalled.Added, want)
+	}
+	if want := []string{"opensc"}; !slices.Equal(diff.PackagesInstalled.Removed, want) {
+		t.Fatalf("PackagesInstalled.Removed = %v, want %v", diff.PackagesInstalled.Removed, want)
+	}
+	if want := []string{"44", "latest"}; !slices.Equal(diff.Tags.Added, want) {
+		t.Fatalf("Tags.Added = %v, want %v", diff.Tags.Added, want)
+	}
+	if c := diff.Labels.Changed["org.opencontainers.image.version"]; c.From != "43" || c.To != "44" {
+		t.Fatalf("Labels.Changed = %v, want version 43 => 44", diff.Labels.Changed)
+	}
+	if _, ok := diff.Labels.Removed["only.from"]; !ok {
+		t.Fatalf("Labels.Removed = %v, want only.from", diff.Labels.Removed)
+	}
+
+	text := diff.String()
+	for _, want := range []string{
+		"--- silverblue-main:43 (43)\n",
+		"+++ niri-main:44 (44)\n",
+		"packagesInstalled:\n+ niri\n- opensc\n",
+		"~ org.opencontainers.image.version=43 => 44\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("String() = %q, want it to contain %q", text, want)
+		}
+	}
+}
+
+func TestDiffPlansRepoTemplates(t *testing.T) {
+	t.Parallel()
+
+	set := &packageSet{
+		ReposForImage: []rule{{
+			Items: []string{"https://example.com/fedora-FEDORA_MAJOR_VERSION/example.repo"},
+		}},
+	}
+
+	from, err := resolvePlan(set, selectorEnv{Version: "43"})
+	if err != nil {
+		t.Fatalf("resolvePlan() unexpected error: %v", err)
+	}
+	to, err := resolvePlan(set, selectorEnv{Version: "44"})
+	if err != nil {
+		t.Fatalf("resolvePlan() unexpected error: %v", err)
+	}
+
+	if diff := diffPlans(from, to); !diff.ReposForImage.empty() {
+		t.Fatalf("ReposForImage = %+v, want no differences between versions", diff.ReposForImage)
+	}
+}
+
+func TestDiffPlansNoDifferences(t *testing.T) {
+	t.Parallel()
+
+	plan := &buildPlan{PackagesInstalled: plannedItems{{Name: "fish"}}}
+	if text := diffPlans(plan, plan).String(); !strings.HasSuffix(text, "no differences\n") {
+		t.Fatalf("String() = %q, want no differences", text)
+	}
+}
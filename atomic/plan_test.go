@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// update rewrites the golden files of TestPlanGolden
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestResolvePlan(t *testing.T) {
+	t.Parallel()
+
+	set := &packageSet{
+		ReposForBuild: []rule{
+			{Items: []string{"https://example.com/FEDORA_MAJOR_VERSION/niri.repo"}},
+			{Items: []string{"https://example.com/FEDORA_MAJOR_VERSION/future.repo"}},
+		},
+		ReposForImage: []rule{
+			{Items: []string{"https://example.com/layering.repo"}},
+		},
+		PackagesInstalled: []rule{
+			{Items: []string{"fish"}},
+			{
+				When:   "variant == niri",
+				Repo:   "niri",
+				Items:  []string{"niri"},
+				Origin: "atomic/packages.yaml:4",
+			},
+			{When: "version >= 44", Repo: "future", Items: []string{"future"}},
+		},
+	}
+
+	plan, err := resolvePlan(set, selectorEnv{Variant: Niri, Suffix: Main, Version: "43"})
+	if err != nil {
+		t.Fatalf("resolvePlan() unexpected error: %v", err)
+	}
+
+	// only build repos needed by selected packages are enabled
+	if want := []string{"https://example.com/43/niri.repo"}; !slices.Equal(plan.ReposForBuild.names(), want) {
+		t.Fatalf("ReposForBuild = %v, want %v", plan.ReposForBuild.names(), want)
+	}
+
+	if want := []string{"https://example.com/layering.repo"}; !slices.Equal(plan.ReposForImage.names(), want) {
+		t.Fatalf("ReposForImage = %v, want %v", plan.ReposForImage.names(), want)
+	}
+
+	want := plannedItems{
+		{Name: "fish", Rule: All, Origin: builtInOrigin},
+		{
+			Name:   "niri",
+			Rule:   "variant == niri",
+			Repo:   "niri",
+			Origin: "atomic/packages.yaml:4",
+		},
+	}
+	if !slices.Equal(plan.PackagesInstalled, want) {
+		t.Fatalf("PackagesInstalled = %v, want %v", plan.PackagesInstalled, want)
+	}
+
+	if len(plan.PackagesRemoved) != 0 || plan.PackagesRemoved == nil {
+		t.Fatalf("PackagesRemoved = %#v, want empty list", plan.PackagesRemoved)
+	}
+}
+
+func TestResolvePlanDefaultBuildRepos(t *testing.T) {
+	t.Parallel()
+
+	niriOnly := []string{
+		"copr:scottames/awww",
+		"copr:scottames/hypr",
+		"copr:tofik/nwg-shell",
+		"copr:yalter/niri",
+	}
+
+	for _, env := range []selectorEnv{
+		{Variant: Silverblue, Suffix: Main, Version: "43", Arch: "x86_64"},
+		{Variant: Niri, Suffix: Main, Version: "43", Arch: "x86_64"},
+	} {
+		plan, err := resolvePlan(defaultPackageSet(), env)
+		if err != nil {
+			t.Fatalf("resolvePlan(%s) unexpected error: %v", env, err)
+		}
+
+		repos := []string{}
+		for _, repo := range plan.ReposForBuild {
+			repos = append(repos, repoID(repo.Name))
+		}
+
+		for _, id := range niriOnly {
+			if got, want := slices.Contains(repos, id), env.Variant == Niri; got != want {
+				t.Errorf("%s: ReposForBuild contains %s = %t, want %t", env, id, got, want)
+			}
+		}
+
+		if !slices.Contains(repos, "copr:scottames/ghostty") {
+			t.Errorf("%s: ReposForBuild = %v, want copr:scottames/ghostty", env, repos)
+		}
+	}
+}
+
+func TestResolvePlanInvalidSelector(t *testing.T) {
+	t.Parallel()
+
+	set := &packageSet{
+		PackagesInstalled: []rule{{When: "variant >", Items: []string{"fish"}}},
+	}
+
+	if _, err := resolvePlan(set, selectorEnv{}); err == nil {
+		t.Fatal("resolvePlan() expected an error for an invalid selector")
+	}
+}
+
+func TestBaseVariant(t *testing.T) {
+	t.Parallel()
+
+	for variant, want := range map[string]string{
+		Silverblue: Silverblue,
+		Niri:       Silverblue,
+		"kinoite":  "kinoite",
+	} {
+		if got := baseVariant(variant); got != want {
+			t.Errorf("baseVariant(%s) = %s, want %s", variant, got, want)
+		}
+	}
+}
+
+// ciMatrix is the build matrix of the atomic workflow
+type ciMatrix struct {
+	Registry []string `yaml:"registry"`
+	Org      []string `yaml:"org"`
+	Variant  []string `yaml:"variant"`
+	Suffix   []string `yaml:"suffix"`
+	Version  []string `yaml:"version"`
+}
+
+// readCIMatrix reads the build matrix of .github/workflows/atomic.yaml
+func readCIMatrix(t *testing.T) ciMatrix {
+	t.Helper()
+
+	data, err := os.ReadFile("../.github/workflows/atomic.yaml")
+	if err != nil {
+		t.Fatalf("unable to read workflow: %v", err)
+	}
+
+	workflow := struct {
+		Jobs map[string]struct {
+			Strategy struct {
+				Matrix ciMatrix `yaml:"matrix"`
+			} `yaml:"strategy"`
+		} `yaml:"jobs"`
+	}{}
+	if err := yaml.Unmarshal(data, &workflow); err != nil {
+		t.Fatalf("unable to parse workflow: %v", err)
+	}
+
+	matrix := workflow.Jobs["build_push"].Strategy.Matrix
+	if len(matrix.Variant) == 0 || len(matrix.Suffix) == 0 || len(matrix.Version) == 0 {
+		t.Fatalf("workflow matrix = %+v, want variants, suffixes and versions", matrix)
+	}
+
+	return matrix
+}
+
+// TestPlanGolden resolves the plan of every variant, suffix and version of
+// the CI matrix, with atomic/packages.yaml if present, and compares it to
+// testdata/plans. Run go test -run TestPlanGolden -update after changing
+// the package rules and review the diff
+func TestPlanGolden(t *testing.T) {
+	t.Parallel()
+
+	set := defaultPackageSet()
+	if data, err := os.ReadFile("packages.yaml"); err == nil {
+		m, err := parseManifest("atomic/packages.yaml", data)
+		if err != nil {
+			t.Fatalf("parseManifest() unexpected error: %v", err)
+		}
+		set = m.apply(set)
+	}
+
+	matrix := readCIMatrix(t)
+	golden := map[string]bool{}
+	for _, registry := range matrix.Registry {
+		for _, org := range matrix.Org {
+			for _, variant := range matrix.Variant {
+				for _, suffix := range matrix.Suffix {
+					for _, version := range matrix.Version {
+						in := planInput{
+							Env: selectorEnv{
+								Variant: variant,
+								Suffix:  suffix,
+								Version: version,
+								Arch:    "x86_64",
+							},
+							Org:  org,
+							Tag:  version,
+							Tags: []string{version},
+							BaseImage: fmt.Sprintf("%s/%s/%s-%s:%s",
+								registry, org, baseVariant(variant), suffix, version),
+							BaseImageVersion: version + ".20261018.0",
+						}
+
+						name := fmt.Sprintf("%s-%s-%s-%s.json", variant, suffix, version, in.Env.Arch)
+						golden[name] = true
+
+						t.Run(name, func(t *testing.T) {
+							t.Parallel()
+							testPlanGolden(t, set, in, filepath.Join("testdata", "plans", name))
+						})
+					}
+				}
+			}
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join("testdata", "plans", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		if !golden[filepath.Base(file)] && !*update {
+			t.Errorf("%s is not in the CI matrix, remove it", file)
+		}
+	}
+}
+
+// testPlanGolden compares the plan of the input to the golden file
+func testPlanGolden(t *testing.T, set *packageSet, in planInput, file string) {
+	t.Helper()
+
+	plan, err := planFromInput(set, in)
+	if err != nil {
+		t.Fatalf("planFromInput() unexpected error: %v", err)
+	}
+
+	out, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(out) + "\n"
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("unable to read golden file, run go test -run TestPlanGolden -update: %v", err)
+	}
+
+	if got != string(want) {
+		t.Errorf("plan differs from %s, run go test -run TestPlanGolden -update and review the diff\ngot:\n%s", file, got)
+	}
+}
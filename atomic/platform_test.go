@@ -0,0 +1,30 @@
+package main
+
+import (
+	"dagger/atomic/internal/dagger"
+	"testing"
+)
+
+func TestCheckArch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		platform dagger.Platform
+		wantErr  bool
+	}{
+		{platform: "linux/amd64"},
+		{platform: "linux/arm64"},
+		{platform: "linux/arm64/v8"},
+		{platform: "linux/s390x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.platform), func(t *testing.T) {
+			t.Parallel()
+
+			if err := checkArch(tt.platform); (err != nil) != tt.wantErr {
+				t.Errorf("checkArch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Typed subset of containers-policy.json(5). Fields not modelled here are
+// kept as is when a policy is read and written back.
+
+const (
+	policyPath = "/etc/containers/policy.json"
+
+	policyTransportDocker = "docker"
+
+	policyTypeInsecureAcceptAnything = "insecureAcceptAnything"
+	policyTypeSigstoreSigned         = "sigstoreSigned"
+
+	signedIdentityMatchRepository = "matchRepository"
+	signedIdentityMatchExact      = "matchExact"
+	signedIdentityRemapIdentity   = "remapIdentity"
+)
+
+// policy is a containers-policy.json document
+type policy struct {
+	Default []policyRequirement `json:"default"`
+	// Transports maps transport => scope => requirements
+	Transports map[string]map[string][]policyRequirement `json:"transports,omitempty"`
+}
+
+// policyRequirement is a policy requirement, e.g. sigstoreSigned
+type policyRequirement struct {
+	Type           string          `json:"type"`
+	KeyType        string          `json:"keyType,omitempty"`
+	KeyPath        string          `json:"keyPath,omitempty"`
+	KeyPaths       []string        `json:"keyPaths,omitempty"`
+	KeyData        string          `json:"keyData,omitempty"`
+	SignedIdentity *signedIdentity `json:"signedIdentity,omitempty"`
+
+	// extra are fields not modelled above, e.g. fulcio or pki
+	extra map[string]json.RawMessage
+}
+
+// signedIdentity is the identity a signature must match
+type signedIdentity struct {
+	Type             string `json:"type"`
+	DockerReference  string `json:"dockerReference,omitempty"`
+	DockerRepository string `json:"dockerRepository,omitempty"`
+	Prefix           string `json:"prefix,omitempty"`
+	SignedPrefix     string `json:"signedPrefix,omitempty"`
+}
+
+// policyRequirementFields are the JSON fields modelled by policyRequirement
+var policyRequirementFields = []string{
+	"type", "keyType", "keyPath", "keyPaths", "keyData", "signedIdentity",
+}
+
+func (r *policyRequirement) UnmarshalJSON(data []byte) error {
+	// alias drops the methods, avoiding recursion
+	type alias policyRequirement
+	if err := json.Unmarshal(data, (*alias)(r)); err != nil {
+		return err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	for _, name := range policyRequirementFields {
+		delete(fields, name)
+	}
+
+	if len(fields) > 0 {
+		r.extra = fields
+	}
+
+	return nil
+}
+
+func (r policyRequirement) MarshalJSON() ([]byte, error) {
+	type alias policyRequirement
+	data, err := json.Marshal(alias(r))
+	if err != nil || len(r.extra) == 0 {
+		return data, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	for name, value := range r.extra {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+// defaultPolicy is the policy used if the image does not have one, the
+// containers-common default
+func defaultPolicy() *policy {
+	return &policy{
+		Default: []policyRequirement{{Type: policyTypeInsecureAcceptAnything}},
+	}
+}
+
+// parsePolicy parses a containers-policy.json document
+func parsePolicy(data []byte) (*policy, error) {
+	p := &policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", policyPath, err)
+	}
+
+	if len(p.Default) == 0 {
+		return nil, fmt.Errorf("invalid %s: missing default requirements", policyPath)
+	}
+
+	return p, nil
+}
+
+// setRequirements sets the requirements of the transport scope, replacing
+// any existing requirements of the scope. Setting the same requirements
+// again does not change the policy
+func (p *policy) setRequirements(
+	transport string,
+	scope string,
+	requirements []policyRequirement,
+) {
+	if p.Transports == nil {
+		p.Transports = map[string]map[string][]policyRequirement{}
+	}
+
+	if p.Transports[transport] == nil {
+		p.Transports[transport] = map[string][]policyRequirement{}
+	}
+
+	p.Transports[transport][scope] = requirements
+}
+
+// encode returns the policy as indented JSON
+func (p *policy) encode() (string, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(p); err != nil {
+		return "", fmt.Errorf("unable to encode %s: %w", policyPath, err)
+	}
+
+	return buf.String(), nil
+}
+
+// sigstoreSigned returns a sigstoreSigned requirement accepting a signature
+// by any of the public keys at keyPaths, matching identity
+func sigstoreSigned(identity signedIdentity, keyPaths ...string) policyRequirement {
+	r := policyRequirement{
+		Type:           policyTypeSigstoreSigned,
+		SignedIdentity: &identity,
+	}
+
+	// keyPath is understood by older containers/image versions, keyPaths is
+	// only needed while rotating keys
+	if len(keyPaths) == 1 {
+		r.KeyPath = keyPaths[0]
+	} else {
+		r.KeyPaths = keyPaths
+	}
+
+	return r
+}
+
+// imageRepository returns the repository of an image reference, without its
+// tag and digest, e.g. ghcr.io/foo/bar:43@sha256:... => ghcr.io/foo/bar
+func imageRepository(ref string) string {
+	name, _, _ := strings.Cut(ref, "@")
+
+	// strip the tag, the last colon after the last slash
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+
+	return name
+}
+
+// policyScopes returns the unique repositories of the image references,
+// the policy scopes they are pulled by
+func policyScopes(refs []string) []string {
+	scopes := []string{}
+	for _, ref := range refs {
+		if scope := imageRepository(ref); !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	slices.Sort(scopes)
+
+	return scopes
+}
+
+// signingRequirements returns the docker transport policy scopes and their
+// requirements for the published image references, requiring a signature by
+// any of the keys at keyPaths.
+//
+// identity is one of:
+//   - matchRepository: the signature is for the same repository
+//   - matchExact: the signature is for the exact reference pulled, each
+//     reference gets a scope of its own. Signing the digest is not enough,
+//     cosign must also sign each tag reference, e.g. with
+//     --sign-container-identity <ref>
+//   - remapIdentity: like matchRepository, additionally requiring images
+//     pulled from remapPrefix/<name> to be signed for the published repository,
+//     e.g. a mirror of the registry
+func signingRequirements(
+	refs []string,
+	identity string,
+	remapPrefix string,
+	keyPaths []string,
+) (map[string][]policyRequirement, error) {
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no image references to sign")
+	}
+
+	switch identity {
+	case signedIdentityMatchRepository, signedIdentityMatchExact:
+	case signedIdentityRemapIdentity:
+		if remapPrefix == "" {
+			return nil, fmt.Errorf("signed identity %s requires a prefix", identity)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signed identity: %q", identity)
+	}
+
+	requirements := map[string][]policyRequirement{}
+	if identity == signedIdentityMatchExact {
+		for _, ref := range refs {
+			requirements[ref] = []policyRequirement{
+				sigstoreSigned(signedIdentity{Type: identity}, keyPaths...),
+			}
+		}
+
+		return requirements, nil
+	}
+
+	for _, scope := range policyScopes(refs) {
+		if identity != signedIdentityRemapIdentity {
+			requirements[scope] = []policyRequirement{
+				sigstoreSigned(signedIdentity{Type: identity}, keyPaths...),
+			}
+			continue
+		}
+
+		requirements[scope] = []policyRequirement{
+			sigstoreSigned(signedIdentity{Type: signedIdentityMatchRepository}, keyPaths...),
+		}
+
+		prefix := strings.TrimSuffix(remapPrefix, "/") + "/" + path.Base(scope)
+		requirements[prefix] = []policyRequirement{
+			sigstoreSigned(signedIdentity{
+				Type:         signedIdentityRemapIdentity,
+				Prefix:       prefix,
+				SignedPrefix: scope,
+			}, keyPaths...),
+		}
+	}
+
+	return requirements, nil
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// fedoraPolicy is the policy.json shipped by Fedora Atomic desktops
+const fedoraPolicy = `{
+    "default": [
+        {
+            "type": "insecureAcceptAnything"
+        }
+    ],
+    "transports": {
+        "docker": {
+            "registry.access.redhat.com": [
+                {
+                    "type": "signedBy",
+                    "keyType": "GPGKeys",
+                    "keyPaths": ["/etc/pki/rpm-gpg/RPM-GPG-KEY-redhat-release", "/etc/pki/rpm-gpg/RPM-GPG-KEY-redhat-beta-2"]
+                }
+            ],
+            "quay.io/example": [
+                {
+                    "type": "sigstoreSigned",
+                    "fulcio": {
+                        "caPath": "/etc/pki/fulcio.pem",
+                        "oidcIssuer": "https://example.com",
+                        "subjectEmail": "ci@example.com"
+                    },
+                    "rekorPublicKeyPath": "/etc/pki/rekor.pub",
+                    "signedIdentity": {"type": "matchRepository"}
+                }
+            ]
+        },
+        "docker-daemon": {
+            "": [
+                {
+                    "type": "insecureAcceptAnything"
+                }
+            ]
+        }
+    }
+}`
+
+var matchRepository = signedIdentity{Type: signedIdentityMatchRepository}
+
+func TestPolicySetRequirements(t *testing.T) {
+	t.Parallel()
+
+	p, err := parsePolicy([]byte(fedoraPolicy))
+	if err != nil {
+		t.Fatalf("parsePolicy() unexpected error: %v", err)
+	}
+
+	want := []policyRequirement{sigstoreSigned(matchRepository, "/etc/pki/containers/atomic.pub")}
+	p.setRequirements(policyTransportDocker, "ghcr.io/foo/containers", want)
+
+	first, err := p.encode()
+	if err != nil {
+		t.Fatalf("encode() unexpected error: %v", err)
+	}
+
+	// merging again, from the written policy, must not change it
+	again, err := parsePolicy([]byte(first))
+	if err != nil {
+		t.Fatalf("parsePolicy() of the merged policy unexpected error: %v", err)
+	}
+	again.setRequirements(policyTransportDocker, "ghcr.io/foo/containers", want)
+
+	second, err := again.encode()
+	if err != nil {
+		t.Fatalf("encode() unexpected error: %v", err)
+	}
+	if first != second {
+		t.Fatalf("setRequirements() is not idempotent:\n%s\n!=\n%s", first, second)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(first), &got); err != nil {
+		t.Fatalf("encode() is not valid JSON: %v", err)
+	}
+
+	docker := got["transports"].(map[string]any)["docker"].(map[string]any)
+	scope := docker["ghcr.io/foo/containers"].([]any)
+	if len(scope) != 1 {
+		t.Fatalf("ghcr.io/foo/containers has %d requirements, want 1", len(scope))
+	}
+	if r := scope[0].(map[string]any); r["type"] != policyTypeSigstoreSigned ||
+		r["keyPath"] != "/etc/pki/containers/atomic.pub" {
+		t.Fatalf("ghcr.io/foo/containers requirement = %v", r)
+	}
+
+	// unrelated scopes and unmodelled fields are kept
+	if _, ok := docker["registry.access.redhat.com"]; !ok {
+		t.Fatal("registry.access.redhat.com scope was dropped")
+	}
+	for _, field := range []string{`"fulcio"`, `"rekorPublicKeyPath"`, `"docker-daemon"`, `"keyType": "GPGKeys"`} {
+		if !strings.Contains(first, field) {
+			t.Fatalf("merged policy is missing %s:\n%s", field, first)
+		}
+	}
+}
+
+func TestPolicyReplacesExistingScope(t *testing.T) {
+	t.Parallel()
+
+	p := defaultPolicy()
+	p.setRequirements(policyTransportDocker, "ghcr.io/foo/containers",
+		[]policyRequirement{sigstoreSigned(matchRepository, "/etc/pki/containers/old.pub")})
+	p.setRequirements(policyTransportDocker, "ghcr.io/foo/containers",
+		[]policyRequirement{sigstoreSigned(matchRepository, "/etc/pki/containers/new.pub")})
+
+	got := p.Transports[policyTransportDocker]["ghcr.io/foo/containers"]
+	if len(got) != 1 || got[0].KeyPath != "/etc/pki/containers/new.pub" {
+		t.Fatalf("requirements = %+v, want only new.pub", got)
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name:    "invalid JSON",
+			data:    "{",
+			wantErr: "unable to parse /etc/containers/policy.json: unexpected end of JSON input",
+		},
+		{
+			name:    "missing default",
+			data:    `{"transports": {}}`,
+			wantErr: "invalid /etc/containers/policy.json: missing default requirements",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parsePolicy([]byte(tt.data))
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("parsePolicy() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		keys     int
+		wantJSON string
+	}{
+		{
+			name:     "single key",
+			keys:     1,
+			wantJSON: `{"type":"sigstoreSigned","keyPath":"/etc/pki/containers/atomic.pub","signedIdentity":{"type":"matchRepository"}}`,
+		},
+		{
+			name:     "rotation window",
+			keys:     2,
+			wantJSON: `{"type":"sigstoreSigned","keyPaths":["/etc/pki/containers/atomic.pub","/etc/pki/containers/atomic-2.pub"],"signedIdentity":{"type":"matchRepository"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			paths := signingKeyPaths("atomic", tt.keys)
+			if len(paths) != tt.keys {
+				t.Fatalf("signingKeyPaths() = %v, want %d paths", paths, tt.keys)
+			}
+
+			got, err := json.Marshal(sigstoreSigned(matchRepository, paths...))
+			if err != nil {
+				t.Fatalf("json.Marshal() unexpected error: %v", err)
+			}
+
+			if string(got) != tt.wantJSON {
+				t.Errorf("sigstoreSigned() = %s, want %s", got, tt.wantJSON)
+			}
+		})
+	}
+}
+
+func TestSigningRequirementsMatchPublishedRefs(t *testing.T) {
+	t.Parallel()
+
+	keyPaths := []string{"/etc/pki/containers/atomic.pub"}
+
+	tests := []struct {
+		name          string
+		imageRegistry string
+		imageName     string
+		tags          []string
+		identity      string
+		remapPrefix   string
+		wantScopes    map[string]signedIdentity
+		wantErr       string
+	}{
+		{
+			name:          "registry namespace",
+			imageRegistry: "ghcr.io/foo",
+			imageName:     "atomic-silverblue-main",
+			tags:          []string{"43", "43-20261018", "20261018"},
+			identity:      signedIdentityMatchRepository,
+			wantScopes: map[string]signedIdentity{
+				"ghcr.io/foo/atomic-silverblue-main": matchRepository,
+			},
+		},
+		{
+			name:          "skip registry namespace",
+			imageRegistry: "ghcr.io",
+			imageName:     "atomic",
+			tags:          []string{"43"},
+			identity:      signedIdentityMatchRepository,
+			wantScopes: map[string]signedIdentity{
+				"ghcr.io/atomic": matchRepository,
+			},
+		},
+		{
+			name:          "registry with port",
+			imageRegistry: "registry:5000",
+			imageName:     "atomic",
+			tags:          []string{"43", "latest"},
+			identity:      signedIdentityMatchRepository,
+			wantScopes: map[string]signedIdentity{
+				"registry:5000/atomic": matchRepository,
+			},
+		},
+		{
+			name:          "match exact",
+			imageRegistry: "ghcr.io/foo",
+			imageName:     "atomic",
+			tags:          []string{"43", "latest"},
+			identity:      signedIdentityMatchExact,
+			wantScopes: map[string]signedIdentity{
+				"ghcr.io/foo/atomic:43":     {Type: signedIdentityMatchExact},
+				"ghcr.io/foo/atomic:latest": {Type: signedIdentityMatchExact},
+			},
+		},
+		{
+			name:          "remap identity",
+			imageRegistry: "ghcr.io/foo",
+			imageName:     "atomic",
+			tags:          []string{"43"},
+			identity:      signedIdentityRemapIdentity,
+			remapPrefix:   "mirror.example.com/ghcr/foo/",
+			wantScopes: map[string]signedIdentity{
+				"ghcr.io/foo/atomic": matchRepository,
+				"mirror.example.com/ghcr/foo/atomic": {
+					Type:         signedIdentityRemapIdentity,
+					Prefix:       "mirror.example.com/ghcr/foo/atomic",
+					SignedPrefix: "ghcr.io/foo/atomic",
+				},
+			},
+		},
+		{
+			name:          "remap identity without prefix",
+			imageRegistry: "ghcr.io/foo",
+			imageName:     "atomic",
+			tags:          []string{"43"},
+			identity:      signedIdentityRemapIdentity,
+			wantErr:       "signed identity remapIdentity requires a prefix",
+		},
+		{
+			name:          "unsupported identity",
+			imageRegistry: "ghcr.io/foo",
+			imageName:     "atomic",
+			tags:          []string{"43"},
+			identity:      "matchRepoDigestOrExact",
+			wantErr:       `unsupported signed identity: "matchRepoDigestOrExact"`,
+		},
+		{
+			name:          "no tags",
+			imageRegistry: "ghcr.io/foo",
+			imageName:     "atomic",
+			identity:      signedIdentityMatchRepository,
+			wantErr:       "no image references to sign",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			refs := publishRefs(tt.imageRegistry, tt.imageName, tt.tags)
+			got, err := signingRequirements(refs, tt.identity, tt.remapPrefix, keyPaths)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("signingRequirements() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("signingRequirements() unexpected error: %v", err)
+			}
+
+			// every pushed reference must be covered by a scope of its own
+			// repository, the most specific scope containers/image matches,
+			// or with matchExact of the reference itself
+			for _, ref := range refs {
+				scope := imageRepository(ref)
+				if scope+":"+ref[len(scope)+1:] != ref {
+					t.Fatalf("imageRepository(%q) = %q is not a prefix of the ref", ref, scope)
+				}
+				if tt.identity == signedIdentityMatchExact {
+					scope = ref
+				}
+				if _, ok := got[scope]; !ok {
+					t.Errorf("pushed ref %s has no policy scope %s in %v", ref, scope, got)
+				}
+			}
+
+			if len(got) != len(tt.wantScopes) {
+				t.Fatalf("signingRequirements() scopes = %v, want %v", got, tt.wantScopes)
+			}
+			for scope, identity := range tt.wantScopes {
+				requirements := got[scope]
+				if len(requirements) != 1 {
+					t.Fatalf("scope %s has %d requirements, want 1", scope, len(requirements))
+				}
+
+				r := requirements[0]
+				if r.Type != policyTypeSigstoreSigned || r.KeyPath != keyPaths[0] {
+					t.Errorf("scope %s requirement = %+v", scope, r)
+				}
+				if r.SignedIdentity == nil || *r.SignedIdentity != identity {
+					t.Errorf("scope %s signedIdentity = %+v, want %+v", scope, r.SignedIdentity, identity)
+				}
+			}
+		})
+	}
+}
@@ -3,10 +3,28 @@ package main
 import (
 	"context"
 	"dagger/atomic/internal/dagger"
+	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 )
 
+// publication is what publish built and pushed
+type publication struct {
+	plan      *buildPlan
+	sbom      *sbomDocument
+	startedOn time.Time
+	// destinations in the order of Atomic.Published
+	destinations []*Destination
+	tags         []string
+	// baseImage is the base image reference including its digest, if known
+	baseImage string
+	// dryRun publications are built but not pushed, the sbom is nil if
+	// only the plan was resolved
+	dryRun bool
+}
+
 // publish builds and publishes the Fedora Atomic container image
 func (a *Atomic) publish(
 	ctx context.Context,
@@ -14,7 +32,8 @@ func (a *Atomic) publish(
 	imageRegistry string,
 	// name of the image
 	imageName string,
-	// repository name, if different from imageName
+	// repository name the signing policy also requires signatures for, if
+	// different from imageName
 	// +optional
 	repository *string,
 	// registry username
@@ -34,6 +53,20 @@ func (a *Atomic) publish(
 	// +optional
 	// +default=false
 	skipSigningConfig bool,
+	// public keys accepted by the signing config, e.g. the current and next
+	// key while rotating keys. Defaults to cosign.pub of the source
+	// +optional
+	signingPublicKeys []*dagger.File,
+	// signed identity required by the signing policy: matchRepository,
+	// matchExact (each tag must also be signed, see signingRequirements) or
+	// remapIdentity
+	// +optional
+	// +default="matchRepository"
+	signedIdentity string,
+	// remapIdentity prefix images are also pulled from, e.g. a registry
+	// mirror, verified as signed for the published repository
+	// +optional
+	signedIdentityPrefix string,
 	// skip namespacing registry with username
 	//   example:
 	//     registry=ghcr.io username=foo
@@ -46,58 +79,317 @@ func (a *Atomic) publish(
 	// +optional
 	// +default=false
 	skipDefaultTags bool,
-) (*Atomic, error) {
-	ctr, err := a.Container(ctx)
+	// build the image and report what would be published and signed,
+	// validating the registry credentials, without pushing anything
+	// +optional
+	// +default=false
+	dryRun bool,
+	// with dryRun, only resolve the plan instead of building the image
+	// +optional
+	// +default=false
+	dryRunPlanOnly bool,
+	// skip Lint, publishing images with lint errors
+	// +optional
+	// +default=false
+	skipLint bool,
+	// registry service bound as "registry", pushed to over plain HTTP, see
+	// TestPublish
+	// +optional
+	registryService *dagger.Service,
+) (*publication, error) {
+	startedOn := time.Now()
+
+	var ctr *dagger.Container
+	var plan *buildPlan
+	var doc *sbomDocument
+	if dryRun && dryRunPlanOnly {
+		var err error
+		_, plan, err = a.plan(ctx)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		ctr, plan, err = a.fedoraAtomic(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err = a.sbom(ctx, ctr, plan, imageName)
+		if err != nil {
+			return nil, err
+		}
+
+		a.PublishedSbom, err = doc.files()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the publish arguments are the primary destination
+	primary := &Destination{
+		Registry: imageRegistry,
+		Username: username,
+		Secret:   secret,
+		service:  registryService,
+	}
+	if !skipRegistryNamespace {
+		primary.Namespace = username
+	}
+	destinations := append([]*Destination{primary}, a.Destinations...)
+
+	// copy, appending must not write to the backing array of the caller
+	tags := slices.Clone(additionalTags)
+	if !skipDefaultTags {
+		tags = append(tags, a.Tags...)
+	}
+
+	destinationRefs, err := publishedRefs(destinations, imageName, tags)
 	if err != nil {
 		return nil, err
 	}
 
-	if secret != nil {
+	if ctr != nil {
+		ctr, err = a.publishedImage(
+			ctx,
+			ctr,
+			slices.Concat(destinationRefs...),
+			primary.prefix(),
+			imageName,
+			repository,
+			skipSigningConfig,
+			signingPublicKeys,
+			signedIdentity,
+			signedIdentityPrefix,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if !skipLint {
+			findings, err := lint(ctx, ctr)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := lintError(findings); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	p := &publication{
+		plan:         plan,
+		sbom:         doc,
+		startedOn:    startedOn,
+		destinations: destinations,
+		tags:         tags,
+		baseImage:    baseImageRef(ctx, plan.BaseImage),
+		dryRun:       dryRun,
+	}
+
+	if dryRun {
+		if ctr != nil {
+			if _, err := ctr.Sync(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		for i, d := range destinations {
+			err := checkPushAuth(ctx, d.auth(), imageRepository(destinationRefs[i][0]))
+			if err != nil {
+				return nil, fmt.Errorf("destination %s: %w", d.prefix(), err)
+			}
+
+			a.PublishedRefs = append(a.PublishedRefs, destinationRefs[i]...)
+			a.Published = append(a.Published, &PublishedDestination{
+				Registry: d.prefix(),
+				Refs:     destinationRefs[i],
+			})
+		}
+
+		return p, nil
+	}
+
+	for _, d := range destinations {
+		if d.Secret == nil {
+			continue
+		}
+
 		// NOTE: the auth step MUST be bare registry w/o username namespace
-		ctr = ctr.WithRegistryAuth(imageRegistry, username, secret)
+		ctr = ctr.WithRegistryAuth(d.Registry, d.Username, d.Secret)
 	}
 
-	if !skipRegistryNamespace {
-		imageRegistry = strings.ToLower(fmt.Sprintf("%s/%s", imageRegistry, username))
+	// push once per destination, the remaining tags point at the same digest
+	for i, d := range destinations {
+		dRefs := destinationRefs[i]
+
+		published, err := pushImage(ctx, ctr, dRefs[0], d.auth())
+		if err != nil {
+			return nil, err
+		}
+
+		digest, err := canonicalDigest(published)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := tagDigest(ctx, ctr, digest, dRefs[1:], d.auth()); err != nil {
+			return nil, err
+		}
+
+		if a.Digest == "" {
+			a.Digest = digest
+		}
+		a.Digests = append(a.Digests, digest)
+		a.PublishedRefs = append(a.PublishedRefs, dRefs...)
+		a.Published = append(a.Published, &PublishedDestination{
+			Registry: d.prefix(),
+			Digest:   digest,
+			Refs:     dRefs,
+		})
 	}
 
-	if repository == nil {
-		repository = &imageName
+	return p, nil
+}
+
+// publishedRefs returns the refs each of the destinations publishes
+func publishedRefs(destinations []*Destination, imageName string, tags []string) ([][]string, error) {
+	destinationRefs := [][]string{}
+	for _, d := range destinations {
+		dRefs, err := d.refs(imageName, tags)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(dRefs) == 0 {
+			return nil, fmt.Errorf("no tags to publish %s/%s as", d.prefix(), imageName)
+		}
+
+		destinationRefs = append(destinationRefs, dRefs)
 	}
 
+	return destinationRefs, nil
+}
+
+// publishedImage returns the image as it is published as refs, with the
+// signing config unless skipSigningConfig, and finalized
+func (a *Atomic) publishedImage(
+	ctx context.Context,
+	ctr *dagger.Container,
+	refs []string,
+	// registry including the namespace of the primary destination
+	imageRegistry string,
+	imageName string,
+	repository *string,
+	skipSigningConfig bool,
+	signingPublicKeys []*dagger.File,
+	signedIdentity string,
+	signedIdentityPrefix string,
+) (*dagger.Container, error) {
 	if !skipSigningConfig {
-		ctr = a.ctrSigningConfig(
+		// the policy also covers the repository if named, it is not pushed to
+		if repository != nil && *repository != imageName {
+			refs = append(slices.Clone(refs), fmt.Sprintf("%s/%s", imageRegistry, *repository))
+		}
+
+		var err error
+		ctr, err = a.ctrSigningConfig(
+			ctx,
 			ctr,
-			*repository,
+			refs,
 			imageRegistry,
 			imageName,
 			a.ReleaseVersion,
+			signingPublicKeys,
+			signedIdentity,
+			signedIdentityPrefix,
 		)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	ctr = ctr.WithLabel("org.opencontainers.image.title", imageName).
-		// NOTE: this must be the last thing to run prior to publishing
-		WithExec([]string{"ostree", "container", "commit"})
+	return finalize(ctr, imageName), nil
+}
 
-	tags := additionalTags
-	if !skipDefaultTags {
-		tags = append(tags, a.Tags...)
+// baseImageRef returns the base image reference including its digest, the
+// digest is informational, the reference is kept if unavailable
+func baseImageRef(ctx context.Context, baseImage string) string {
+	if baseImage == "" {
+		return ""
+	}
+
+	ref, err := dag.Container().From(baseImage).ImageRef(ctx)
+	if err != nil {
+		return baseImage
+	}
+
+	return ref
+}
+
+// result returns the PublishResult of the publication
+func (a *Atomic) result(p *publication) *PublishResult {
+	return &PublishResult{
+		Digest:         a.Digest,
+		Refs:           a.PublishedRefs,
+		Tags:           p.tags,
+		Destinations:   a.Published,
+		BaseImage:      p.baseImage,
+		ReleaseVersion: a.ReleaseVersion,
+		Sbom:           a.PublishedSbom,
+		DryRun:         p.dryRun,
 	}
+}
 
-	// TODO: better to  do this similar to multi-stage passing multiple
-	// containers to publish?
+// publishRefs returns the image references the image is published as
+func publishRefs(imageRegistry, imageName string, tags []string) []string {
+	refs := []string{}
 	for _, tag := range tags {
-		digest, err := ctr.Publish(
-			ctx,
-			fmt.Sprintf("%s/%s:%s", imageRegistry, imageName, tag),
-		)
-		if err != nil {
-			return nil, err
-		}
-		a.Digests = append(a.Digests, digest)
+		refs = append(refs, fmt.Sprintf("%s/%s:%s", imageRegistry, imageName, tag))
 	}
 
-	return a, nil
+	return refs
+}
+
+// provenance returns the provenance predicate of the publication
+func (a *Atomic) provenance(
+	ctx context.Context,
+	p *publication,
+	imageRegistry string,
+	imageName string,
+) ([]byte, error) {
+	suffix := ""
+	if a.Suffix != nil {
+		suffix = *a.Suffix
+	}
+
+	out, err := json.MarshalIndent(newProvenance(provenanceInput{
+		Revision:  gitRevision(ctx, a.Source),
+		BaseImage: p.baseImage,
+		Parameters: map[string]any{
+			"registry":          a.Registry,
+			"org":               a.Org,
+			"variant":           a.Variant,
+			"suffix":            suffix,
+			"tag":               a.Tag,
+			"manifest":          a.Manifest,
+			"locked":            a.Locked,
+			"additionalLabels":  a.Labels,
+			"skipDefaultLabels": a.SkipDefaultLabels,
+			"imageRegistry":     imageRegistry,
+			"imageName":         imageName,
+		},
+		Plan:       p.plan,
+		Packages:   p.sbom.Components,
+		StartedOn:  p.startedOn,
+		FinishedOn: time.Now(),
+	}), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode provenance: %w", err)
+	}
+
+	return out, nil
 }
 
 // Publish build and publish the Fedora atomic container image
@@ -107,7 +399,8 @@ func (a *Atomic) Publish(
 	imageRegistry string,
 	// name of the image
 	imageName string,
-	// repository name, if different from imageName
+	// repository name the signing policy also requires signatures for, if
+	// different from imageName
 	// +optional
 	repository *string,
 	// registry username
@@ -127,6 +420,20 @@ func (a *Atomic) Publish(
 	// +optional
 	// +default=false
 	skipSigningConfig bool,
+	// public keys accepted by the signing config, e.g. the current and next
+	// key while rotating keys. Defaults to cosign.pub of the source
+	// +optional
+	signingPublicKeys []*dagger.File,
+	// signed identity required by the signing policy: matchRepository,
+	// matchExact (each tag must also be signed, see signingRequirements) or
+	// remapIdentity
+	// +optional
+	// +default="matchRepository"
+	signedIdentity string,
+	// remapIdentity prefix images are also pulled from, e.g. a registry
+	// mirror, verified as signed for the published repository
+	// +optional
+	signedIdentityPrefix string,
 	// skip namespacing registry with username
 	//   example:
 	//     registry=ghcr.io username=foo
@@ -139,8 +446,21 @@ func (a *Atomic) Publish(
 	// +optional
 	// +default=false
 	skipDefaultTags bool,
-) ([]string, error) {
-	_, err := a.publish(
+	// build the image and report what would be published and signed,
+	// validating the registry credentials, without pushing anything
+	// +optional
+	// +default=false
+	dryRun bool,
+	// with dryRun, only resolve the plan instead of building the image
+	// +optional
+	// +default=false
+	dryRunPlanOnly bool,
+	// skip Lint, publishing images with lint errors
+	// +optional
+	// +default=false
+	skipLint bool,
+) (*PublishResult, error) {
+	published, err := a.publish(
 		ctx,
 		imageRegistry,
 		imageName,
@@ -149,14 +469,21 @@ func (a *Atomic) Publish(
 		secret,
 		additionalTags,
 		skipSigningConfig,
+		signingPublicKeys,
+		signedIdentity,
+		signedIdentityPrefix,
 		skipRegistryNamespace,
 		skipDefaultTags,
+		dryRun,
+		dryRunPlanOnly,
+		skipLint,
+		nil,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return a.Digests, nil
+	return a.result(published), nil
 }
 
 // PublishAndSign build, publish, and sign (via cosign)
@@ -167,7 +494,8 @@ func (a *Atomic) PublishAndSign(
 	imageRegistry string,
 	// name of the image
 	imageName string,
-	// repository name, if different from imageName
+	// repository name the signing policy also requires signatures for, if
+	// different from imageName
 	// +optional
 	repository *string,
 	// registry username
@@ -187,6 +515,20 @@ func (a *Atomic) PublishAndSign(
 	// +optional
 	// +default=false
 	skipSigningConfig bool,
+	// public keys accepted by the signing config, e.g. the current and next
+	// key while rotating keys. Defaults to cosign.pub of the source
+	// +optional
+	signingPublicKeys []*dagger.File,
+	// signed identity required by the signing policy: matchRepository,
+	// matchExact (each tag must also be signed, see signingRequirements) or
+	// remapIdentity
+	// +optional
+	// +default="matchRepository"
+	signedIdentity string,
+	// remapIdentity prefix images are also pulled from, e.g. a registry
+	// mirror, verified as signed for the published repository
+	// +optional
+	signedIdentityPrefix string,
 	// skip namespacing registry with username
 	//   example:
 	//     registry=ghcr.io username=foo
@@ -199,6 +541,19 @@ func (a *Atomic) PublishAndSign(
 	// +optional
 	// +default=false
 	skipDefaultTags bool,
+	// build the image and report what would be published and signed,
+	// validating the registry credentials, without pushing anything
+	// +optional
+	// +default=false
+	dryRun bool,
+	// with dryRun, only resolve the plan instead of building the image
+	// +optional
+	// +default=false
+	dryRunPlanOnly bool,
+	// skip Lint, publishing images with lint errors
+	// +optional
+	// +default=false
+	skipLint bool,
 	// Cosign private key
 	cosignPrivateKey dagger.Secret,
 	// Cosign password
@@ -214,8 +569,29 @@ func (a *Atomic) PublishAndSign(
 	// +optional
 	// +default="nonroot"
 	cosignUser *string,
-) ([]string, error) {
-	_, err := a.publish(
+	// skip attaching SBOM and provenance attestations
+	// +optional
+	// +default=false
+	skipAttestations bool,
+) (*PublishResult, error) {
+	signer := cosignOpts{
+		Image:            *cosignImage,
+		User:             *cosignUser,
+		PrivateKey:       &cosignPrivateKey,
+		Password:         &cosignPassword,
+		Registry:         imageRegistry,
+		RegistryUsername: username,
+		RegistryPassword: secret,
+		DockerConfig:     dockerConfig,
+	}
+
+	// never publish images the signing policy cannot verify
+	err := checkSigningKey(ctx, signer, a.publicKeys(signingPublicKeys))
+	if err != nil {
+		return nil, err
+	}
+
+	published, err := a.publish(
 		ctx,
 		imageRegistry,
 		imageName,
@@ -224,40 +600,130 @@ func (a *Atomic) PublishAndSign(
 		secret,
 		additionalTags,
 		skipSigningConfig,
+		signingPublicKeys,
+		signedIdentity,
+		signedIdentityPrefix,
 		skipRegistryNamespace,
 		skipDefaultTags,
+		dryRun,
+		dryRunPlanOnly,
+		skipLint,
+		nil,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	opts := dagger.CosignSignOpts{
-		// Should never be nil due to Dagger setting default values
-		CosignImage: *cosignImage,
-		CosignUser:  *cosignUser,
+	result := a.result(published)
+	if dryRun {
+		result.wouldSign(!skipAttestations)
+
+		return result, nil
 	}
-	if secret != nil {
-		opts.RegistryUsername = username
-		opts.RegistryPassword = secret
+
+	err = a.signPublished(ctx, published, result, signer, skipAttestations, imageRegistry, imageName)
+	if err != nil {
+		return nil, err
 	}
-	if dockerConfig != nil {
-		opts.DockerConfig = dockerConfig
+
+	return result, nil
+}
+
+// signPublished signs the published digest in each of the destinations with
+// the cosign key of signer and, unless skipAttestations, attests its SBOM and
+// provenance, recording the signatures and attestations in the result
+func (a *Atomic) signPublished(
+	ctx context.Context,
+	published *publication,
+	result *PublishResult,
+	signer cosignOpts,
+	skipAttestations bool,
+	imageRegistry string,
+	imageName string,
+) error {
+	signers := []cosignOpts{}
+	for _, d := range published.destinations {
+		destinationSigner := signer
+		destinationSigner.Registry = d.Registry
+		destinationSigner.RegistryUsername = d.Username
+		destinationSigner.RegistryPassword = d.Secret
+		destinationSigner.RegistryService = d.service
+		signers = append(signers, destinationSigner)
 	}
 
-	cosignStdout, err := dag.Cosign().Sign(
-		ctx,
-		&cosignPrivateKey,
-		&cosignPassword,
-		a.Digests,
-		opts,
-	)
+	for i, destinationSigner := range signers {
+		digests := []string{result.Destinations[i].Digest}
+
+		// the cosign module cannot reach a registry service, e.g. the
+		// ephemeral registry of TestPublish, sign from a bound container
+		var err error
+		if destinationSigner.RegistryService != nil {
+			err = sign(ctx, destinationSigner, digests)
+		} else {
+			err = cosignSign(ctx, destinationSigner, digests)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := result.signed(result.Destinations[i]); err != nil {
+			return err
+		}
+	}
+
+	if skipAttestations {
+		return nil
+	}
+
+	provenance, err := a.provenance(ctx, published, imageRegistry, imageName)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	output := append([]string{"Published:"}, a.Digests...)
-	output = append(output, "")
-	output = append(output, cosignStdout...)
+	provenanceFile := dag.Directory().
+		WithNewFile("provenance.json", string(provenance)).
+		File("provenance.json")
+
+	for i, destinationSigner := range signers {
+		err := attest(
+			ctx,
+			destinationSigner,
+			[]string{result.Destinations[i].Digest},
+			map[string]*dagger.File{
+				attestSbomType:       a.PublishedSbom.File(sbomSpdxFile),
+				attestProvenanceType: provenanceFile,
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := result.attested(result.Destinations[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cosignSign signs each of the digests with the cosign module
+func cosignSign(ctx context.Context, opts cosignOpts, digests []string) error {
+	signOpts := dagger.CosignSignOpts{
+		CosignImage: opts.Image,
+		CosignUser:  opts.User,
+	}
+	if opts.RegistryPassword != nil {
+		signOpts.RegistryUsername = opts.RegistryUsername
+		signOpts.RegistryPassword = opts.RegistryPassword
+	}
+	if opts.DockerConfig != nil {
+		signOpts.DockerConfig = opts.DockerConfig
+	}
+
+	_, err := dag.Cosign().Sign(ctx, opts.PrivateKey, opts.Password, digests, signOpts)
+	if err != nil {
+		return fmt.Errorf("unable to sign %s: %w", strings.Join(digests, ", "), err)
+	}
 
-	return output, nil
+	return nil
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAttachmentRef(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		digestRef string
+		suffix    string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "signature",
+			digestRef: "ghcr.io/foo/atomic@sha256:abc",
+			suffix:    signatureSuffix,
+			want:      "ghcr.io/foo/atomic:sha256-abc.sig",
+		},
+		{
+			name:      "attestation of a tagged digest",
+			digestRef: "registry:5000/atomic:43@sha256:abc",
+			suffix:    attestationSuffix,
+			want:      "registry:5000/atomic:sha256-abc.att",
+		},
+		{
+			name:      "no digest",
+			digestRef: "ghcr.io/foo/atomic:43",
+			suffix:    signatureSuffix,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := attachmentRef(tt.digestRef, tt.suffix)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("attachmentRef() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("attachmentRef() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublishResult(t *testing.T) {
+	t.Parallel()
+
+	newResult := func() *PublishResult {
+		return &PublishResult{
+			Digest: "ghcr.io/foo/atomic@sha256:abc",
+			Refs:   []string{"ghcr.io/foo/atomic:43", "quay.io/bar/atomic:43"},
+			Tags:   []string{"43"},
+			Destinations: []*PublishedDestination{
+				{
+					Registry: "ghcr.io/foo",
+					Digest:   "ghcr.io/foo/atomic@sha256:abc",
+					Refs:     []string{"ghcr.io/foo/atomic:43"},
+				},
+				{
+					Registry: "quay.io/bar",
+					Digest:   "quay.io/bar/atomic@sha256:abc",
+					Refs:     []string{"quay.io/bar/atomic:43"},
+				},
+			},
+			BaseImage:      "quay.io/fedora/fedora-silverblue@sha256:def",
+			ReleaseVersion: "43",
+		}
+	}
+
+	tests := []struct {
+		name             string
+		sign             bool
+		attest           bool
+		wantSignatures   []string
+		wantAttestations []string
+	}{
+		{
+			name:             "published",
+			wantSignatures:   []string{},
+			wantAttestations: []string{},
+		},
+		{
+			name: "signed",
+			sign: true,
+			wantSignatures: []string{
+				"ghcr.io/foo/atomic:sha256-abc.sig",
+				"quay.io/bar/atomic:sha256-abc.sig",
+			},
+			wantAttestations: []string{},
+		},
+		{
+			name:   "signed and attested",
+			sign:   true,
+			attest: true,
+			wantSignatures: []string{
+				"ghcr.io/foo/atomic:sha256-abc.sig",
+				"quay.io/bar/atomic:sha256-abc.sig",
+			},
+			wantAttestations: []string{
+				"ghcr.io/foo/atomic:sha256-abc.att",
+				"quay.io/bar/atomic:sha256-abc.att",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := newResult()
+			for _, d := range r.Destinations {
+				if tt.sign {
+					if err := r.signed(d); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if tt.attest {
+					if err := r.attested(d); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			out, err := r.Json()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded := publishResultJSON{}
+			if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+				t.Fatalf("Json() is not valid JSON: %v\n%s", err, out)
+			}
+
+			if decoded.Digest != r.Digest || decoded.ReleaseVersion != "43" ||
+				decoded.BaseImage != r.BaseImage || len(decoded.Destinations) != 2 {
+				t.Errorf("Json() = %s", out)
+			}
+			if !slices.Equal(decoded.Signatures, tt.wantSignatures) {
+				t.Errorf("Json() signatures = %v, want %v", decoded.Signatures, tt.wantSignatures)
+			}
+			if !slices.Equal(decoded.Attestations, tt.wantAttestations) {
+				t.Errorf("Json() attestations = %v, want %v", decoded.Attestations, tt.wantAttestations)
+			}
+
+			text := r.Text()
+			for _, want := range append(
+				[]string{"Published quay.io/bar:", "quay.io/bar/atomic:43", "Release version: 43"},
+				append(tt.wantSignatures, tt.wantAttestations...)...,
+			) {
+				if !strings.Contains(text, want) {
+					t.Errorf("Text() does not contain %q:\n%s", want, text)
+				}
+			}
+		})
+	}
+}
+
+func TestPublishResultDryRun(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		attest          bool
+		wantWouldAttest []string
+	}{
+		{
+			name: "sign",
+		},
+		{
+			name:            "sign and attest",
+			attest:          true,
+			wantWouldAttest: []string{"ghcr.io/foo/atomic", "quay.io/bar/atomic"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := &PublishResult{
+				Refs: []string{"ghcr.io/foo/atomic:43", "quay.io/bar/atomic:43"},
+				Tags: []string{"43"},
+				Destinations: []*PublishedDestination{
+					{Registry: "ghcr.io/foo", Refs: []string{"ghcr.io/foo/atomic:43"}},
+					{Registry: "quay.io/bar", Refs: []string{"quay.io/bar/atomic:43"}},
+				},
+				ReleaseVersion: "43",
+				DryRun:         true,
+			}
+			r.wouldSign(tt.attest)
+
+			wantWouldSign := []string{"ghcr.io/foo/atomic", "quay.io/bar/atomic"}
+			if !slices.Equal(r.WouldSign, wantWouldSign) {
+				t.Errorf("WouldSign = %v, want %v", r.WouldSign, wantWouldSign)
+			}
+			if !slices.Equal(r.WouldAttest, tt.wantWouldAttest) {
+				t.Errorf("WouldAttest = %v, want %v", r.WouldAttest, tt.wantWouldAttest)
+			}
+
+			out, err := r.Json()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded := publishResultJSON{}
+			if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+				t.Fatalf("Json() is not valid JSON: %v\n%s", err, out)
+			}
+			if !decoded.DryRun || decoded.Digest != "" || decoded.Destinations[0].Digest != "" {
+				t.Errorf("Json() = %s", out)
+			}
+
+			text := r.Text()
+			for _, want := range []string{"Would publish quay.io/bar:", "nothing was pushed", "ghcr.io/foo/atomic:43"} {
+				if !strings.Contains(text, want) {
+					t.Errorf("Text() does not contain %q:\n%s", want, text)
+				}
+			}
+			if strings.Contains(text, "Published") {
+				t.Errorf("Text() of a dry run reports a publish:\n%s", text)
+			}
+		})
+	}
+}
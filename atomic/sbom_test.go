@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseSbomPackages(t *testing.T) {
+	t.Parallel()
+
+	out := "fish\t0\t3.7.1\t5.fc43\tx86_64\tGPL-2.0-only AND LGPL-2.0-or-later\tFedora Project\n" +
+		"gpg-pubkey\t0\tdeadbeef\t1\t(none)\tpubkey\t(none)\n" +
+		"shim-x64\t1\t15.8\t3\tx86_64\tBSD-3-Clause\t(none)\n"
+
+	got, err := parseSbomPackages(out, "43")
+	if err != nil {
+		t.Fatalf("parseSbomPackages() unexpected error: %v", err)
+	}
+
+	want := []sbomComponent{
+		{
+			Name:             "fish",
+			Version:          "3.7.1-5.fc43",
+			License:          "GPL-2.0-only AND LGPL-2.0-or-later",
+			Supplier:         "Fedora Project",
+			DownloadLocation: sbomNoAssertion,
+			Purl:             "pkg:rpm/fedora/fish@3.7.1-5.fc43?arch=x86_64&distro=fedora-43",
+		},
+		{
+			Name:             "shim-x64",
+			Version:          "1:15.8-3",
+			License:          "BSD-3-Clause",
+			DownloadLocation: sbomNoAssertion,
+			Purl:             "pkg:rpm/fedora/shim-x64@15.8-3?arch=x86_64&distro=fedora-43&epoch=1",
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseSbomPackages() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("parseSbomPackages()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestScriptPayloadVersions(t *testing.T) {
+	t.Parallel()
+
+	for _, payload := range scriptPayloads {
+		if _, err := os.Stat("scripts/" + payload.Script); err != nil {
+			t.Fatalf("payload %s refers to a missing script: %v", payload.Name, err)
+		}
+
+		if payload.VersionVar == "" {
+			continue
+		}
+
+		script, err := os.ReadFile("scripts/" + payload.Script)
+		if err != nil {
+			t.Fatalf("read %s: %v", payload.Script, err)
+		}
+
+		if v := scriptVariable(string(script), payload.VersionVar); !versionPattern.MatchString(v) {
+			t.Fatalf("%s in %s = %q, want a version", payload.VersionVar, payload.Script, v)
+		}
+	}
+}
+
+func TestPayloadComponent(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		payload scriptPayload
+		version string
+		arch    string
+		want    string
+	}{
+		{
+			name:    "obsidian x86_64",
+			payload: scriptPayloads[0],
+			version: "1.11.5",
+			arch:    "x86_64",
+			want:    "https://github.com/obsidianmd/obsidian-releases/releases/download/v1.11.5/obsidian-1.11.5.tar.gz",
+		},
+		{
+			name:    "obsidian aarch64",
+			payload: scriptPayloads[0],
+			version: "1.11.5",
+			arch:    "aarch64",
+			want:    "https://github.com/obsidianmd/obsidian-releases/releases/download/v1.11.5/obsidian-1.11.5-arm64.tar.gz",
+		},
+		{
+			name:    "zed aarch64",
+			payload: scriptPayloads[1],
+			version: "0.200.4",
+			arch:    "aarch64",
+			want:    "https://cloud.zed.dev/releases/stable/latest/download?asset=zed&arch=aarch64&os=linux",
+		},
+		{
+			name:    "unknown version",
+			payload: scriptPayloads[0],
+			arch:    "aarch64",
+			want:    sbomNoAssertion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := payloadComponent(tt.payload, tt.version, tt.arch)
+			if got.DownloadLocation != tt.want {
+				t.Fatalf("payloadComponent() downloadLocation = %q, want %q", got.DownloadLocation, tt.want)
+			}
+		})
+	}
+}
+
+func TestSbomDocument(t *testing.T) {
+	t.Parallel()
+
+	doc := &sbomDocument{
+		Name:    "atomic-silverblue-main",
+		Version: "43",
+		Created: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Components: []sbomComponent{
+			{Name: "fish", Version: "3.7.1-5.fc43", Purl: "pkg:rpm/fedora/fish@3.7.1-5.fc43?arch=x86_64"},
+			payloadComponent(scriptPayloads[0], "1.11.5", "x86_64"),
+		},
+	}
+
+	spdx, err := doc.spdx()
+	if err != nil {
+		t.Fatalf("spdx() unexpected error: %v", err)
+	}
+
+	var spdxDoc struct {
+		SpdxVersion  string `json:"spdxVersion"`
+		CreationInfo struct {
+			Created string `json:"created"`
+		} `json:"creationInfo"`
+		Packages []struct {
+			Name             string `json:"name"`
+			DownloadLocation string `json:"downloadLocation"`
+			LicenseDeclared  string `json:"licenseDeclared"`
+		} `json:"packages"`
+		Relationships []struct{} `json:"relationships"`
+	}
+	if err := json.Unmarshal(spdx, &spdxDoc); err != nil {
+		t.Fatalf("spdx() is not valid JSON: %v", err)
+	}
+
+	if spdxDoc.SpdxVersion != "SPDX-2.3" || spdxDoc.CreationInfo.Created != "2026-01-02T03:04:05Z" {
+		t.Fatalf("spdx() header = %+v", spdxDoc)
+	}
+	// the image plus its components, each contained by the image
+	if len(spdxDoc.Packages) != 3 || len(spdxDoc.Relationships) != 3 {
+		t.Fatalf("spdx() has %d packages and %d relationships, want 3 and 3",
+			len(spdxDoc.Packages), len(spdxDoc.Relationships))
+	}
+	if p := spdxDoc.Packages[1]; p.LicenseDeclared != sbomNoAssertion {
+		t.Fatalf("spdx() licenseDeclared = %q, want %q", p.LicenseDeclared, sbomNoAssertion)
+	}
+	if p := spdxDoc.Packages[2]; p.DownloadLocation != "https://github.com/obsidianmd/obsidian-releases/releases/download/v1.11.5/obsidian-1.11.5.tar.gz" {
+		t.Fatalf("spdx() obsidian downloadLocation = %q", p.DownloadLocation)
+	}
+
+	cdx, err := doc.cycloneDX()
+	if err != nil {
+		t.Fatalf("cycloneDX() unexpected error: %v", err)
+	}
+
+	var cdxDoc struct {
+		BomFormat    string `json:"bomFormat"`
+		SerialNumber string `json:"serialNumber"`
+		Components   []struct {
+			Purl string `json:"purl"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(cdx, &cdxDoc); err != nil {
+		t.Fatalf("cycloneDX() is not valid JSON: %v", err)
+	}
+
+	if cdxDoc.BomFormat != "CycloneDX" || len(cdxDoc.SerialNumber) != len("urn:uuid:")+36 {
+		t.Fatalf("cycloneDX() header = %+v", cdxDoc)
+	}
+	if len(cdxDoc.Components) != 2 || cdxDoc.Components[1].Purl != "pkg:generic/obsidian@1.11.5" {
+		t.Fatalf("cycloneDX() components = %+v", cdxDoc.Components)
+	}
+}
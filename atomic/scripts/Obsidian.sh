@@ -11,16 +11,31 @@ set -ouex pipefail
 # renovate: datasource=github-releases depName=obsidianmd/obsidian-releases
 OBSIDIAN_VERSION="v1.11.5"
 
-echo "=> Installing Obsidian ${OBSIDIAN_VERSION}"
+case "$(uname -m)" in
+  x86_64)
+    OBSIDIAN_ARCH_SUFFIX=""
+    ;;
+  aarch64 | arm64)
+    OBSIDIAN_ARCH_SUFFIX="-arm64"
+    ;;
+  *)
+    echo "Unsupported Obsidian architecture: $(uname -m)" >&2
+    exit 1
+    ;;
+esac
+
+OBSIDIAN_DIR="obsidian-${OBSIDIAN_VERSION#v}${OBSIDIAN_ARCH_SUFFIX}"
+
+echo "=> Installing Obsidian ${OBSIDIAN_VERSION} ($(uname -m))"
 
 # Download and extract
-DOWNLOAD_URL="https://github.com/obsidianmd/obsidian-releases/releases/download/${OBSIDIAN_VERSION}/obsidian-${OBSIDIAN_VERSION#v}.tar.gz"
+DOWNLOAD_URL="https://github.com/obsidianmd/obsidian-releases/releases/download/${OBSIDIAN_VERSION}/${OBSIDIAN_DIR}.tar.gz"
 curl -fsSL "${DOWNLOAD_URL}" | tar -xz -C /tmp
 
 # Install to /usr/share/obsidian (safe for ostree - baked into image)
 mkdir -p /usr/share/obsidian
-cp -a /tmp/obsidian-"${OBSIDIAN_VERSION#v}"/* /usr/share/obsidian/
-rm -rf /tmp/obsidian-"${OBSIDIAN_VERSION#v}"
+cp -a /tmp/"${OBSIDIAN_DIR}"/* /usr/share/obsidian/
+rm -rf /tmp/"${OBSIDIAN_DIR}"
 
 # Create symlink for binary
 ln -s /usr/share/obsidian/obsidian /usr/bin/obsidian
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A selector is a small boolean expression deciding whether a rule applies to
+// the image being built, e.g.
+//
+//	variant == niri && version >= 43 && !(suffix == nvidia)
+//
+// Grammar, from lowest to highest precedence:
+//
+//	expr       = and { "||" and }
+//	and        = unary { "&&" unary }
+//	unary      = "!" unary | "(" expr ")" | "all" | comparison | word
+//	comparison = field ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) value
+//	field      = "variant" | "suffix" | "version" | "arch"
+//
+// Values are bare words ([A-Za-z0-9_.-]) or double quoted strings. Ordering
+// operators are only supported for version and compare numerically. A bare
+// word matches if it equals any of variant, suffix or version - the same
+// semantics as the original two-level package maps. An empty selector is
+// equivalent to "all".
+
+const (
+	selectorFieldVariant = "variant"
+	selectorFieldSuffix  = "suffix"
+	selectorFieldVersion = "version"
+	selectorFieldArch    = "arch"
+)
+
+var selectorFields = []string{
+	selectorFieldVariant,
+	selectorFieldSuffix,
+	selectorFieldVersion,
+	selectorFieldArch,
+}
+
+// selectorEnv is the image being built as seen by a selector
+type selectorEnv struct {
+	Variant string
+	Suffix  string
+	Version string
+	Arch    string
+}
+
+func (e selectorEnv) field(name string) string {
+	switch name {
+	case selectorFieldVariant:
+		return e.Variant
+	case selectorFieldSuffix:
+		return e.Suffix
+	case selectorFieldVersion:
+		return e.Version
+	case selectorFieldArch:
+		return e.Arch
+	}
+
+	return ""
+}
+
+// selector is a parsed selector expression
+type selector struct {
+	expr string
+	root selectorNode
+}
+
+// Match reports whether the selector matches the given environment
+func (s *selector) Match(env selectorEnv) bool {
+	return s.root.match(env)
+}
+
+// selectorError is a selector parsing error, Column is 1-based
+type selectorError struct {
+	Expr   string
+	Column int
+	Msg    string
+}
+
+func (e *selectorError) Error() string {
+	return fmt.Sprintf("invalid selector %q: column %d: %s", e.Expr, e.Column, e.Msg)
+}
+
+// parseSelector parses the given selector expression
+func parseSelector(expr string) (*selector, error) {
+	tokens, err := tokenizeSelector(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &selectorParser{expr: expr, tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return &selector{expr: expr, root: allNode{}}, nil
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+
+	return &selector{expr: expr, root: root}, nil
+}
+
+type selectorNode interface {
+	match(env selectorEnv) bool
+}
+
+type allNode struct{}
+
+func (allNode) match(selectorEnv) bool { return true }
+
+type notNode struct{ node selectorNode }
+
+func (n notNode) match(env selectorEnv) bool { return !n.node.match(env) }
+
+type andNode struct{ left, right selectorNode }
+
+func (n andNode) match(env selectorEnv) bool {
+	return n.left.match(env) && n.right.match(env)
+}
+
+type orNode struct{ left, right selectorNode }
+
+func (n orNode) match(env selectorEnv) bool {
+	return n.left.match(env) || n.right.match(env)
+}
+
+// wordNode is a bare word, matching any of variant, suffix or version
+type wordNode struct{ value string }
+
+func (n wordNode) match(env selectorEnv) bool {
+	return slices.Contains([]string{env.Variant, env.Suffix, env.Version}, n.value)
+}
+
+type compareNode struct {
+	field string
+	op    string
+	value string
+}
+
+func (n compareNode) match(env selectorEnv) bool {
+	actual := env.field(n.field)
+	switch n.op {
+	case "==":
+		return actual == n.value
+	case "!=":
+		return actual != n.value
+	}
+
+	// ordering operators are only allowed for version, enforced by the parser
+	have, err := strconv.Atoi(actual)
+	if err != nil {
+		return false
+	}
+	want, _ := strconv.Atoi(n.value)
+
+	switch n.op {
+	case "<":
+		return have < want
+	case "<=":
+		return have <= want
+	case ">":
+		return have > want
+	case ">=":
+		return have >= want
+	}
+
+	return false
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenNot
+	tokenAnd
+	tokenOr
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of input"
+	case tokenString:
+		return strconv.Quote(t.value)
+	}
+
+	return fmt.Sprintf("%q", t.value)
+}
+
+func isSelectorWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' ||
+		c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '.'
+}
+
+func tokenizeSelector(expr string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		two := ""
+		if i+1 < len(expr) {
+			two = expr[i : i+2]
+		}
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case two == "&&":
+			tokens = append(tokens, token{tokenAnd, two, i})
+			i += 2
+		case two == "||":
+			tokens = append(tokens, token{tokenOr, two, i})
+			i += 2
+		case two == "==" || two == "!=" || two == "<=" || two == ">=":
+			tokens = append(tokens, token{tokenOp, two, i})
+			i += 2
+		case c == '<' || c == '>':
+			tokens = append(tokens, token{tokenOp, string(c), i})
+			i++
+		case c == '!':
+			tokens = append(tokens, token{tokenNot, "!", i})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case c == '"':
+			end := strings.IndexByte(expr[i+1:], '"')
+			if end < 0 {
+				return nil, &selectorError{Expr: expr, Column: i + 1, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{tokenString, expr[i+1 : i+1+end], i})
+			i += end + 2
+		case isSelectorWordChar(c):
+			start := i
+			for i < len(expr) && isSelectorWordChar(expr[i]) {
+				i++
+			}
+			tokens = append(tokens, token{tokenWord, expr[start:i], start})
+		default:
+			return nil, &selectorError{
+				Expr:   expr,
+				Column: i + 1,
+				Msg:    fmt.Sprintf("unexpected character %q", c),
+			}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(expr)}), nil
+}
+
+type selectorParser struct {
+	expr   string
+	tokens []token
+	pos    int
+}
+
+func (p *selectorParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *selectorParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *selectorParser) errorf(t token, format string, args ...any) error {
+	return &selectorError{
+		Expr:   p.expr,
+		Column: t.pos + 1,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *selectorParser) parseOr() (selectorNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *selectorParser) parseAnd() (selectorNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *selectorParser) parseUnary() (selectorNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNot:
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	case tokenLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.errorf(closing, "expected \")\", found %s", closing)
+		}
+		return node, nil
+	case tokenWord, tokenString:
+		if t.kind == tokenWord && t.value == All {
+			return allNode{}, nil
+		}
+		if t.kind == tokenWord && slices.Contains(selectorFields, t.value) {
+			return p.parseComparison(t)
+		}
+		if p.peek().kind == tokenOp {
+			return nil, p.errorf(t, "unknown field %q (expected one of: %s)",
+				t.value, strings.Join(selectorFields, ", "))
+		}
+		return wordNode{t.value}, nil
+	}
+
+	return nil, p.errorf(t, "expected expression, found %s", t)
+}
+
+func (p *selectorParser) parseComparison(field token) (selectorNode, error) {
+	op := p.next()
+	if op.kind != tokenOp {
+		return nil, p.errorf(op, "expected comparison operator after %q, found %s",
+			field.value, op)
+	}
+
+	value := p.next()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, p.errorf(value, "expected value after %q, found %s", op.value, value)
+	}
+
+	if op.value != "==" && op.value != "!=" {
+		if field.value != selectorFieldVersion {
+			return nil, p.errorf(op, "operator %q is only supported for %s",
+				op.value, selectorFieldVersion)
+		}
+		if _, err := strconv.Atoi(value.value); err != nil {
+			return nil, p.errorf(value, "operator %q requires a numeric version, found %s",
+				op.value, value)
+		}
+	}
+
+	return compareNode{field: field.value, op: op.value, value: value.value}, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import "testing"
+
+func TestSelectorMatch(t *testing.T) {
+	t.Parallel()
+
+	niri43 := selectorEnv{Variant: Niri, Suffix: Main, Version: "43", Arch: "x86_64"}
+	silverblueNvidia44 := selectorEnv{Variant: Silverblue, Suffix: Nvidia, Version: "44", Arch: "aarch64"}
+
+	tests := []struct {
+		expr string
+		env  selectorEnv
+		want bool
+	}{
+		{"", niri43, true},
+		{"all", silverblueNvidia44, true},
+		{"niri", niri43, true},
+		{"niri", silverblueNvidia44, false},
+		{"nvidia", silverblueNvidia44, true},
+		{"43", niri43, true},
+		{"variant == niri", niri43, true},
+		{`variant == "niri"`, niri43, true},
+		{"variant != niri", niri43, false},
+		{"version >= 43", niri43, true},
+		{"version > 43", niri43, false},
+		{"version < 44", niri43, true},
+		{"version <= 43", silverblueNvidia44, false},
+		{"arch == aarch64", silverblueNvidia44, true},
+		{"!niri", niri43, false},
+		{"!!niri", niri43, true},
+		{"variant == niri && version >= 43 && !(suffix == nvidia)", niri43, true},
+		{"variant == niri && version >= 43 && !(suffix == nvidia)", silverblueNvidia44, false},
+		// && binds tighter than ||
+		{"silverblue || niri && version >= 44", niri43, false},
+		{"silverblue || niri && version >= 44", silverblueNvidia44, true},
+		{"(silverblue || niri) && version >= 44", niri43, false},
+		{"niri && version >= 44 || version == 43", niri43, true},
+		// ! binds tighter than &&
+		{"!silverblue && niri", niri43, true},
+		{"!(silverblue && nvidia)", silverblueNvidia44, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+
+			s, err := parseSelector(tt.expr)
+			if err != nil {
+				t.Fatalf("parseSelector(%q) unexpected error: %v", tt.expr, err)
+			}
+
+			if got := s.Match(tt.env); got != tt.want {
+				t.Fatalf("parseSelector(%q).Match(%+v) = %t, want %t", tt.expr, tt.env, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectorMatchNonNumericVersion(t *testing.T) {
+	t.Parallel()
+
+	s, err := parseSelector("version >= 43")
+	if err != nil {
+		t.Fatalf("parseSelector() unexpected error: %v", err)
+	}
+
+	if s.Match(selectorEnv{Version: "20250101"}) != true {
+		t.Fatal("expected numeric date versions to compare numerically")
+	}
+
+	if s.Match(selectorEnv{Version: "rawhide"}) {
+		t.Fatal("expected non-numeric versions to never match ordering comparisons")
+	}
+}
+
+func TestSelectorParseErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{
+			expr:    "niri &&",
+			wantErr: `invalid selector "niri &&": column 8: expected expression, found end of input`,
+		},
+		{
+			expr:    "variant niri",
+			wantErr: `invalid selector "variant niri": column 9: expected comparison operator after "variant", found "niri"`,
+		},
+		{
+			expr:    "variant ==",
+			wantErr: `invalid selector "variant ==": column 11: expected value after "==", found end of input`,
+		},
+		{
+			expr:    "suffix > main",
+			wantErr: `invalid selector "suffix > main": column 8: operator ">" is only supported for version`,
+		},
+		{
+			expr:    "version >= forty",
+			wantErr: `invalid selector "version >= forty": column 12: operator ">=" requires a numeric version, found "forty"`,
+		},
+		{
+			expr:    "flavor == niri",
+			wantErr: `invalid selector "flavor == niri": column 1: unknown field "flavor" (expected one of: variant, suffix, version, arch)`,
+		},
+		{
+			expr:    "(niri || silverblue",
+			wantErr: `invalid selector "(niri || silverblue": column 20: expected ")", found end of input`,
+		},
+		{
+			expr:    "niri silverblue",
+			wantErr: `invalid selector "niri silverblue": column 6: unexpected "silverblue"`,
+		},
+		{
+			expr:    "niri & nvidia",
+			wantErr: `invalid selector "niri & nvidia": column 6: unexpected character '&'`,
+		},
+		{
+			expr:    `variant == "niri`,
+			wantErr: `invalid selector "variant == \"niri": column 12: unterminated string`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parseSelector(tt.expr)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("parseSelector(%q) error = %v, want %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
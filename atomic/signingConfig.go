@@ -1,30 +1,108 @@
 package main
 
 import (
+	"context"
 	"dagger/atomic/internal/dagger"
 	"fmt"
+	"path"
+	"slices"
+	"strings"
 )
 
+// signingKeyPaths returns the paths the given number of public keys are
+// written to, the first (current) key keeps the original <image>.pub path
+func signingKeyPaths(imageName string, keys int) []string {
+	paths := []string{}
+	for i := range keys {
+		if i == 0 {
+			paths = append(paths, fmt.Sprintf("/etc/pki/containers/%s.pub", imageName))
+			continue
+		}
+		paths = append(paths, fmt.Sprintf("/etc/pki/containers/%s-%d.pub", imageName, i+1))
+	}
+
+	return paths
+}
+
+// sigstoreAttachments returns the registries.d config enabling sigstore
+// attachments for the registry namespaces of the refs, e.g. ghcr.io/foo
+func sigstoreAttachments(refs []string) string {
+	config := &strings.Builder{}
+	config.WriteString("docker:\n")
+
+	namespaces := []string{}
+	for _, scope := range policyScopes(refs) {
+		if namespace := path.Dir(scope); !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+			fmt.Fprintf(config, "  %s:\n      use-sigstore-attachments: true\n", namespace)
+		}
+	}
+
+	return config.String()
+}
+
+// publicKeys returns the given signing public keys, defaulting to cosign.pub
+// of the source
+func (a *Atomic) publicKeys(keys []*dagger.File) []*dagger.File {
+	if len(keys) == 0 {
+		return []*dagger.File{a.Source.File("cosign.pub")}
+	}
+
+	return keys
+}
+
 // ctrSigningConfig updates the universal-blue-esk signing config
+//
+// the policy requires signatures for the repository of each of the refs to
+// be published, accepting a signature by any of the public keys, defaulting
+// to cosign.pub of the source. To rotate keys publish with the current and
+// next key, sign with the next key once rolled out and retire the current
+// key by no longer passing it
 func (a *Atomic) ctrSigningConfig(
+	ctx context.Context,
 	ctr *dagger.Container,
-	repo string,
+	refs []string,
 	imageRegistry string,
 	imageName string,
 	imageVersion string,
-) *dagger.Container {
+	publicKeys []*dagger.File,
+	// signed identity, see signingRequirements
+	identity string,
+	remapPrefix string,
+) (*dagger.Container, error) {
 	imageInfo := fmt.Sprintf(`{
   "image-ref": "ostree-image-signed:docker://%s/%s",
   "image-tag": "%s"
 }`, imageRegistry, imageName, imageVersion)
 	registriesD := fmt.Sprintf("/etc/containers/registries.d/%s.yaml", imageName)
 
-	yq := dag.Container().From("docker.io/mikefarah/yq")
-	cosignPubKeyPath := fmt.Sprintf("/etc/pki/containers/%s.pub", imageName)
+	publicKeys = a.publicKeys(publicKeys)
+	keyPaths := signingKeyPaths(imageName, len(publicKeys))
+
+	requirements, err := signingRequirements(refs, identity, remapPrefix, keyPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := containerPolicy(ctx, ctr)
+	if err != nil {
+		return nil, err
+	}
+
+	for scope, scopeRequirements := range requirements {
+		p.setRequirements(policyTransportDocker, scope, scopeRequirements)
+	}
+
+	policyJSON, err := p.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range publicKeys {
+		ctr = ctr.WithFile(keyPaths[i], key)
+	}
 
 	return ctr.
-		WithFile("/usr/bin/yq", yq.File("/usr/bin/yq")).
-		WithFile(cosignPubKeyPath, a.Source.File("cosign.pub")).
 		WithNewFile(
 			"/usr/share/ublue-os/image-info.json",
 			imageInfo,
@@ -34,29 +112,36 @@ func (a *Atomic) ctrSigningConfig(
 		).
 		WithNewFile(
 			registriesD,
-			fmt.Sprintf(`docker:
-  %s:
-      use-sigstore-attachments: true
-`, imageRegistry),
+			sigstoreAttachments(refs),
 			dagger.ContainerWithNewFileOpts{
 				Permissions: 0644,
 				Owner:       "root",
 			}).
-		WithExec([]string{
-			"yq", "-i", "-o=j",
-			fmt.Sprintf(`.transports.docker |=
-{"%s/%s": [
-		{
-			"type": "sigstoreSigned",
-			"keyPath": "%s",
-			"signedIdentity": {
-				"type": "matchRepository"
-			}
-		}
-	]
+		WithNewFile(
+			policyPath,
+			policyJSON,
+			dagger.ContainerWithNewFileOpts{
+				Permissions: 0644,
+				Owner:       "root",
+			}), nil
 }
 
-+ .`, imageRegistry, repo, cosignPubKeyPath), // TODO: git repo instead
-			"/etc/containers/policy.json",
-		})
+// containerPolicy reads the containers policy of the container, the
+// containers-common default if it has none
+func containerPolicy(ctx context.Context, ctr *dagger.Container) (*policy, error) {
+	found, err := ctr.Directory("/etc/containers").Glob(ctx, "policy.json")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", policyPath, err)
+	}
+
+	if len(found) == 0 {
+		return defaultPolicy(), nil
+	}
+
+	data, err := ctr.File(policyPath).Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", policyPath, err)
+	}
+
+	return parsePolicy([]byte(data))
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"dagger/atomic/internal/dagger"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// signingKeyMismatchError is returned if the cosign private key does not
+// belong to any of the public keys the published image is verified against
+type signingKeyMismatchError struct {
+	// PublicKey is the public key derived from the private key
+	PublicKey string
+	// Expected are the names of the expected public keys
+	Expected []string
+}
+
+func (e *signingKeyMismatchError) Error() string {
+	return fmt.Sprintf(
+		"cosign private key does not match %s, derived public key:\n%s",
+		strings.Join(e.Expected, ", "),
+		strings.TrimSpace(e.PublicKey),
+	)
+}
+
+// samePublicKey reports whether the PEM encoded public keys a and b are the
+// same key, ignoring whitespace and PEM headers
+func samePublicKey(a, b string) bool {
+	blockA, _ := pem.Decode([]byte(strings.TrimSpace(a)))
+	blockB, _ := pem.Decode([]byte(strings.TrimSpace(b)))
+	if blockA == nil || blockB == nil {
+		return false
+	}
+
+	return bytes.Equal(blockA.Bytes, blockB.Bytes)
+}
+
+// checkSigningKey returns a *signingKeyMismatchError if the public key
+// derived from the cosign private key is none of the given public keys
+func checkSigningKey(
+	ctx context.Context,
+	opts cosignOpts,
+	publicKeys []*dagger.File,
+) error {
+	ctr, err := cosignContainer(ctx, cosignOpts{
+		Image:      opts.Image,
+		User:       opts.User,
+		PrivateKey: opts.PrivateKey,
+		Password:   opts.Password,
+	})
+	if err != nil {
+		return err
+	}
+
+	derived, err := ctr.
+		WithExec([]string{"cosign", "public-key", "--key", "/cosign/cosign.key"}).
+		Stdout(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to derive the cosign public key: %w", err)
+	}
+
+	expected := []string{}
+	for _, key := range publicKeys {
+		contents, err := key.Contents(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to read public key: %w", err)
+		}
+
+		if samePublicKey(derived, contents) {
+			return nil
+		}
+
+		name, err := key.Name(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to read public key: %w", err)
+		}
+		expected = append(expected, name)
+	}
+
+	return &signingKeyMismatchError{PublicKey: derived, Expected: expected}
+}
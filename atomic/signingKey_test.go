@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+const testPublicKey = `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE0dkyRzVe6JwbQMo7b6ZgtgxzqiMq
+J2v0McQxWaCJS/+4w/Kjz+ZJLRMFMOuCeMu/dLqMfKnBdnjNxSXRMt8NOg==
+-----END PUBLIC KEY-----
+`
+
+func TestSamePublicKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want bool
+	}{
+		{
+			name: "same key",
+			a:    testPublicKey,
+			b:    testPublicKey,
+			want: true,
+		},
+		{
+			name: "different line wrapping and whitespace",
+			a:    testPublicKey,
+			b: "\n-----BEGIN PUBLIC KEY-----\n" +
+				"MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE0dkyRzVe6JwbQMo7b6ZgtgxzqiMqJ2v0McQxWaCJS/+4w/Kjz+ZJLRMFMOuCeMu/dLqMfKnBdnjNxSXRMt8NOg==\n" +
+				"-----END PUBLIC KEY-----\n\n",
+			want: true,
+		},
+		{
+			name: "different key",
+			a:    testPublicKey,
+			b: `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEaaaaRzVe6JwbQMo7b6ZgtgxzqiMq
+J2v0McQxWaCJS/+4w/Kjz+ZJLRMFMOuCeMu/dLqMfKnBdnjNxSXRMt8NOg==
+-----END PUBLIC KEY-----`,
+			want: false,
+		},
+		{
+			name: "not PEM",
+			a:    testPublicKey,
+			b:    "Error: reading key: decrypt: encrypted: decryption failed",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := samePublicKey(tt.a, tt.b); got != tt.want {
+				t.Errorf("samePublicKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSigningKeyMismatchError(t *testing.T) {
+	t.Parallel()
+
+	err := fmt.Errorf("publish: %w", &signingKeyMismatchError{
+		PublicKey: testPublicKey,
+		Expected:  []string{"cosign.pub", "cosign.next.pub"},
+	})
+
+	var mismatch *signingKeyMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("errors.As() = false, want *signingKeyMismatchError")
+	}
+
+	want := "cosign private key does not match cosign.pub, cosign.next.pub, derived public key:\n" +
+		"-----BEGIN PUBLIC KEY-----\n" +
+		"MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE0dkyRzVe6JwbQMo7b6ZgtgxzqiMq\n" +
+		"J2v0McQxWaCJS/+4w/Kjz+ZJLRMFMOuCeMu/dLqMfKnBdnjNxSXRMt8NOg==\n" +
+		"-----END PUBLIC KEY-----"
+	if got := mismatch.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
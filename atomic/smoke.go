@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"dagger/atomic/internal/dagger"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// smokeBinary is a binary that must be on the PATH if the package or script
+// installing it is part of the plan
+type smokeBinary struct {
+	Name    string
+	Package string
+	Script  string
+}
+
+// smokeSymlink is a symlink a script creates. Target may only resolve on the
+// live system, e.g. through the tmpfiles.d link /opt/1Password, Resolved is
+// where it resolves to in the image
+type smokeSymlink struct {
+	Link     string
+	Target   string
+	Resolved string
+}
+
+var (
+	// smokeBinaries are the binaries checked by Test
+	smokeBinaries = []smokeBinary{
+		{Name: "ghostty", Package: "ghostty"},
+		{Name: "mise", Package: "mise"},
+		{Name: "tailscale", Package: "tailscale"},
+		{Name: "niri", Package: "niri"},
+		{Name: "op", Script: "1Password.sh"},
+	}
+
+	// smokeSymlinks are the symlinks of each script checked by Test
+	smokeSymlinks = map[string][]smokeSymlink{
+		"1Password.sh": {
+			{
+				Link:     "/usr/bin/1password",
+				Target:   "/opt/1Password/1password",
+				Resolved: "/usr/lib/1Password/1password",
+			},
+		},
+		"Obsidian.sh": {
+			{
+				Link:     "/usr/bin/obsidian",
+				Target:   "/usr/share/obsidian/obsidian",
+				Resolved: "/usr/share/obsidian/obsidian",
+			},
+		},
+		"Zed.sh": {
+			{
+				Link:     "/usr/bin/zed",
+				Target:   "/usr/share/zed.app/bin/zed",
+				Resolved: "/usr/share/zed.app/bin/zed",
+			},
+		},
+	}
+)
+
+// smokeCheck is an assertion run inside the built container, it passes if
+// Args exit 0
+type smokeCheck struct {
+	// Class groups the checks in the JUnit report, e.g. binaries
+	Class string
+	Name  string
+	Args  []string
+}
+
+// bashCheck returns the args running script with bash, the args are passed
+// as $0, $1, ...
+func bashCheck(script string, args ...string) []string {
+	return append([]string{"bash", "-c", script}, args...)
+}
+
+// smokeChecks returns the checks of the plan: the binaries on the PATH, the
+// files of atomic/files/usr/etc present, the removed packages absent, the
+// build repo files deleted and the symlinks of the scripts resolving
+func smokeChecks(plan *buildPlan, usrEtcFiles []string) []smokeCheck {
+	installed := plan.PackagesInstalled.packageNames()
+	scripts := plan.Scripts.names()
+
+	checks := []smokeCheck{}
+	for _, binary := range smokeBinaries {
+		if binary.Package != "" && !slices.Contains(installed, binary.Package) ||
+			binary.Script != "" && !slices.Contains(scripts, binary.Script) {
+			continue
+		}
+
+		checks = append(checks, smokeCheck{
+			Class: "binaries",
+			Name:  binary.Name,
+			Args:  bashCheck(`command -v "$0"`, binary.Name),
+		})
+	}
+
+	for _, file := range usrEtcFiles {
+		name := path.Join("/usr/etc", file)
+		checks = append(checks, smokeCheck{
+			Class: "files",
+			Name:  name,
+			Args:  []string{"test", "-e", name},
+		})
+	}
+
+	for _, pkg := range plan.PackagesRemoved.names() {
+		checks = append(checks, smokeCheck{
+			Class: "packagesRemoved",
+			Name:  pkg,
+			Args:  bashCheck(`! rpm -q "$0"`, pkg),
+		})
+	}
+
+	for _, repo := range plan.ReposForBuild.names() {
+		name := path.Join("/etc/yum.repos.d", path.Base(repo))
+		checks = append(checks, smokeCheck{
+			Class: "reposForBuild",
+			Name:  name,
+			Args:  []string{"test", "!", "-e", name},
+		})
+	}
+
+	for _, script := range scripts {
+		for _, link := range smokeSymlinks[script] {
+			checks = append(checks, smokeCheck{
+				Class: "symlinks",
+				Name:  link.Link,
+				Args: bashCheck(
+					`[ "$(readlink "$0")" = "$1" ] && [ -x "$2" ]`,
+					link.Link,
+					link.Target,
+					link.Resolved,
+				),
+			})
+		}
+	}
+
+	return checks
+}
+
+// smokeResult is the outcome of a smoke check, Output is empty if it passed
+type smokeResult struct {
+	Check  smokeCheck
+	Passed bool
+	Output string
+}
+
+// junitTestSuite is a JUnit XML test suite
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is a JUnit XML test case
+type junitTestCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+// junitFailure is the failure of a JUnit XML test case
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Output  string `xml:",chardata"`
+}
+
+// junitReport returns the JUnit XML report of the results
+func junitReport(suite string, results []smokeResult) (string, error) {
+	report := junitTestSuite{Name: suite, Tests: len(results), TestCases: []junitTestCase{}}
+	for _, result := range results {
+		testCase := junitTestCase{
+			Classname: suite + "." + result.Check.Class,
+			Name:      result.Check.Name,
+		}
+
+		if !result.Passed {
+			report.Failures++
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("%s failed", strings.Join(result.Check.Args, " ")),
+				Output:  result.Output,
+			}
+		}
+
+		report.TestCases = append(report.TestCases, testCase)
+	}
+
+	out, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("unable to encode JUnit report: %w", err)
+	}
+
+	return xml.Header + string(out) + "\n", nil
+}
+
+// runSmokeChecks runs each of the checks in ctr
+func runSmokeChecks(
+	ctx context.Context,
+	ctr *dagger.Container,
+	checks []smokeCheck,
+) ([]smokeResult, error) {
+	results := []smokeResult{}
+	for _, check := range checks {
+		run := ctr.WithExec(check.Args, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny})
+
+		exitCode, err := run.ExitCode(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to run %s: %w", check.Name, err)
+		}
+
+		result := smokeResult{Check: check, Passed: exitCode == 0}
+		if !result.Passed {
+			stdout, _ := run.Stdout(ctx)
+			stderr, _ := run.Stderr(ctx)
+			result.Output = strings.TrimSpace(stdout + stderr)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// Test runs the smoke checks of the plan inside the built container:
+// binaries on the PATH, the files of atomic/files/usr/etc, removed packages
+// absent, build repo files deleted and the symlinks of the scripts. Returns a
+// JUnit XML report, failed checks are reported, not an error
+func (a *Atomic) Test(ctx context.Context) (*dagger.File, error) {
+	ctr, plan, err := a.fedoraAtomic(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usrEtcFiles, err := a.Source.Directory("atomic/files/usr/etc").Glob(ctx, "**/*")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list atomic/files/usr/etc: %w", err)
+	}
+
+	results, err := runSmokeChecks(ctx, ctr, smokeChecks(plan, usrEtcFiles))
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := junitReport("atomic", results)
+	if err != nil {
+		return nil, err
+	}
+
+	return dag.Directory().
+		WithNewFile("junit.xml", report).
+		File("junit.xml"), nil
+}
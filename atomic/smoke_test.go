@@ -0,0 +1,96 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSmokeChecks(t *testing.T) {
+	t.Parallel()
+
+	plan := &buildPlan{
+		ReposForBuild: plannedItems{
+			{Name: "https://example.com/43/niri.repo"},
+		},
+		PackagesInstalled: plannedItems{{Name: "ghostty"}, {Name: "niri"}},
+		PackagesRemoved:   plannedItems{{Name: "opensc"}},
+		Scripts:           plannedItems{{Name: "1Password.sh"}},
+	}
+
+	checks := smokeChecks(plan, []string{"environment", "modules-load.d/dagger.conf"})
+
+	names := []string{}
+	for _, check := range checks {
+		names = append(names, check.Class+" "+check.Name)
+	}
+
+	want := []string{
+		"binaries ghostty",
+		"binaries niri",
+		"binaries op",
+		"files /usr/etc/environment",
+		"files /usr/etc/modules-load.d/dagger.conf",
+		"packagesRemoved opensc",
+		"reposForBuild /etc/yum.repos.d/niri.repo",
+		"symlinks /usr/bin/1password",
+	}
+	if !slices.Equal(names, want) {
+		t.Fatalf("smokeChecks() = %v, want %v", names, want)
+	}
+
+	symlink := checks[len(checks)-1].Args
+	if want := []string{"/usr/bin/1password", "/opt/1Password/1password", "/usr/lib/1Password/1password"}; !slices.Equal(symlink[3:], want) {
+		t.Errorf("symlink args = %v, want %v", symlink[3:], want)
+	}
+}
+
+func TestSmokeChecksLocked(t *testing.T) {
+	t.Parallel()
+
+	plan := &buildPlan{
+		PackagesInstalled: plannedItems{{Name: "ghostty"}, {Name: "niri"}},
+	}
+	lockPlan(plan, &lockfile{Packages: []lockedPackage{
+		{Name: "ghostty", Epoch: "0", Version: "1.2.0", Release: "1.fc43", Arch: "x86_64"},
+		{Name: "gtk4-layer-shell", Epoch: "0", Version: "1.1.1", Release: "1.fc43", Arch: "x86_64"},
+		{Name: "niri", Epoch: "1", Version: "25.08", Release: "1.fc43", Arch: "x86_64"},
+	}}, "atomic/locks/niri-main-43-x86_64.lock.json")
+
+	names := []string{}
+	for _, check := range smokeChecks(plan, nil) {
+		names = append(names, check.Class+" "+check.Name)
+	}
+
+	// the locked plan installs NEVRAs, the binaries are still checked
+	if want := []string{"binaries ghostty", "binaries niri"}; !slices.Equal(names, want) {
+		t.Fatalf("smokeChecks() = %v, want %v", names, want)
+	}
+}
+
+func TestJunitReport(t *testing.T) {
+	t.Parallel()
+
+	report, err := junitReport("atomic", []smokeResult{
+		{Check: smokeCheck{Class: "binaries", Name: "mise", Args: []string{"bash", "-c", `command -v "$0"`, "mise"}}, Passed: true},
+		{
+			Check:  smokeCheck{Class: "packagesRemoved", Name: "opensc", Args: []string{"bash", "-c", `! rpm -q "$0"`, "opensc"}},
+			Output: "opensc-0.26.1-1.fc43.x86_64",
+		},
+	})
+	if err != nil {
+		t.Fatalf("junitReport() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<testsuite name="atomic" tests="2" failures="1">`,
+		`<testcase classname="atomic.binaries" name="mise"></testcase>`,
+		`<testcase classname="atomic.packagesRemoved" name="opensc">`,
+		`<failure message="bash -c ! rpm -q &#34;$0&#34; opensc failed">opensc-0.26.1-1.fc43.x86_64</failure>`,
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("junitReport() = %s, missing %s", report, want)
+		}
+	}
+}
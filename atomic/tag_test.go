@@ -0,0 +1,80 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCanonicalDigest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		published string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "tagged",
+			published: "ghcr.io/foo/atomic:43@sha256:abc",
+			want:      "ghcr.io/foo/atomic@sha256:abc",
+		},
+		{
+			name:      "registry with port",
+			published: "registry:5000/atomic:43@sha256:abc",
+			want:      "registry:5000/atomic@sha256:abc",
+		},
+		{
+			name:      "no digest",
+			published: "ghcr.io/foo/atomic:43",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := canonicalDigest(tt.published)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("canonicalDigest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("canonicalDigest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCraneArgs(t *testing.T) {
+	t.Parallel()
+
+	digest := "ghcr.io/foo/atomic@sha256:abc"
+
+	tests := []struct {
+		name string
+		ref  string
+		want []string
+	}{
+		{
+			name: "same repository",
+			ref:  "ghcr.io/foo/atomic:43-20261018",
+			want: []string{"crane", "tag", digest, "43-20261018"},
+		},
+		{
+			name: "other repository",
+			ref:  "quay.io/foo/atomic:43",
+			want: []string{"crane", "copy", digest, "quay.io/foo/atomic:43"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := craneArgs(digest, tt.ref); !slices.Equal(got, tt.want) {
+				t.Errorf("craneArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMissingTags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		listed string
+		want   []string
+		expect []string
+	}{
+		{
+			name:   "all listed",
+			listed: "e2e\ne2e-latest\nsha256-abc.sig\n",
+			want:   []string{"e2e", "e2e-latest"},
+			expect: []string{},
+		},
+		{
+			name:   "missing",
+			listed: "e2e\n",
+			want:   []string{"e2e", "e2e-latest"},
+			expect: []string{"e2e-latest"},
+		},
+		{
+			name:   "prefix is not a tag",
+			listed: "e2e-latest\n",
+			want:   []string{"e2e"},
+			expect: []string{"e2e"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := missingTags(tt.listed, tt.want); !slices.Equal(got, tt.expect) {
+				t.Errorf("missingTags() = %v, want %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestConfigLabel(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		config  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "labeled",
+			config: `{"architecture":"amd64","config":{"Labels":{"org.opencontainers.image.title":"atomic-e2e"}}}`,
+			want:   "atomic-e2e",
+		},
+		{
+			name:   "no labels",
+			config: `{"architecture":"amd64","config":{}}`,
+		},
+		{
+			name:    "not json",
+			config:  "MANIFEST_UNKNOWN",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := configLabel(tt.config, "org.opencontainers.image.title")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("configLabel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("configLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestReport(t *testing.T) {
+	t.Parallel()
+
+	report, err := testReport([]testCheck{{Name: "tags"}, {Name: "title label"}})
+	if err != nil {
+		t.Fatalf("testReport() error = %v", err)
+	}
+	if report != "ok   tags\nok   title label\n" {
+		t.Errorf("testReport() = %q", report)
+	}
+
+	_, err = testReport([]testCheck{{Name: "tags"}, {Name: "signature", Failure: "no signatures"}})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 checks failed: signature") ||
+		!strings.Contains(err.Error(), "FAIL signature: no signatures") {
+		t.Errorf("testReport() error = %v", err)
+	}
+}
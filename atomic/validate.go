@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// validationMatrix is every image the package rules are validated for,
+	// a superset of the CI build matrix
+	validationMatrix = struct {
+		Variants []string
+		Suffixes []string
+		Versions []string
+		Arches   []string
+	}{
+		Variants: []string{Silverblue, Niri},
+		Suffixes: []string{Main, Nvidia},
+		Versions: []string{"43", "44"},
+		Arches:   []string{"x86_64", "aarch64"},
+	}
+
+	coprRepoURL = regexp.MustCompile(`/coprs/([^/]+)/([^/]+)/repo/`)
+)
+
+// repoID returns the short identifier packages use to reference a repo:
+// copr:<owner>/<project> for copr repos, otherwise the name of the repo file,
+// e.g. https://pkgs.tailscale.com/stable/fedora/tailscale.repo => tailscale
+func repoID(url string) string {
+	if m := coprRepoURL.FindStringSubmatch(url); m != nil {
+		return fmt.Sprintf("copr:%s/%s", m[1], m[2])
+	}
+
+	return strings.TrimSuffix(path.Base(url), ".repo")
+}
+
+// validationEnvs returns the selector environments of the validation matrix
+func validationEnvs() []selectorEnv {
+	envs := []selectorEnv{}
+	for _, variant := range validationMatrix.Variants {
+		for _, suffix := range validationMatrix.Suffixes {
+			for _, version := range validationMatrix.Versions {
+				for _, arch := range validationMatrix.Arches {
+					envs = append(envs, selectorEnv{
+						Variant: variant,
+						Suffix:  suffix,
+						Version: version,
+						Arch:    arch,
+					})
+				}
+			}
+		}
+	}
+
+	return envs
+}
+
+func (e selectorEnv) String() string {
+	return fmt.Sprintf("%s-%s-%s-%s", e.Variant, e.Suffix, e.Version, e.Arch)
+}
+
+// describe returns a short description of the rule an item came from
+func (item plannedItem) describe() string {
+	return fmt.Sprintf("%q (%s)", item.Rule, item.Origin)
+}
+
+// validatePackageSet checks the package set for duplicate packages, packages
+// both installed and removed, packages from repos that are not configured
+// and build repos no package needs. Problems found while resolving the
+// validation matrix are reported once, listing the images they apply to.
+func validatePackageSet(set *packageSet) []string {
+	result := []string{}
+
+	// build repos must be needed by at least one package rule
+	needed := map[string]bool{}
+	for _, rules := range [][]rule{set.PackagesInstalled, set.PackagesRemoved} {
+		for _, r := range rules {
+			if r.Repo != "" {
+				needed[r.Repo] = true
+			}
+		}
+	}
+	for _, r := range set.ReposForBuild {
+		for _, url := range r.Items {
+			if !needed[repoID(url)] {
+				result = append(result, fmt.Sprintf(
+					"repo %q in reposForBuild is not needed by any package", repoID(url),
+				))
+			}
+		}
+	}
+
+	problems := map[string][]string{}
+	report := func(env selectorEnv, format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		problems[msg] = append(problems[msg], env.String())
+	}
+
+	for _, env := range validationEnvs() {
+		plan, err := resolvePlan(set, env)
+		if err != nil {
+			return append(result, err.Error())
+		}
+
+		installed := map[string]plannedItem{}
+		for _, item := range plan.PackagesInstalled {
+			if first, ok := installed[item.Name]; ok {
+				report(env, "package %q is installed more than once: %s and %s",
+					item.Name, first.describe(), item.describe())
+				continue
+			}
+			installed[item.Name] = item
+		}
+
+		removed := map[string]plannedItem{}
+		for _, item := range plan.PackagesRemoved {
+			if first, ok := removed[item.Name]; ok {
+				report(env, "package %q is removed more than once: %s and %s",
+					item.Name, first.describe(), item.describe())
+				continue
+			}
+			removed[item.Name] = item
+
+			if in, ok := installed[item.Name]; ok {
+				report(env, "package %q is both installed by %s and removed by %s",
+					item.Name, in.describe(), item.describe())
+			}
+		}
+
+		repos := map[string]bool{}
+		for _, repo := range append(plan.ReposForBuild, plan.ReposForImage...) {
+			repos[repoID(repo.Name)] = true
+		}
+		for _, item := range plan.PackagesInstalled {
+			if item.Repo != "" && !repos[item.Repo] {
+				report(env, "package %q needs repo %q which is not configured",
+					item.Name, item.Repo)
+			}
+		}
+	}
+
+	for _, msg := range slices.Sorted(maps.Keys(problems)) {
+		result = append(result, fmt.Sprintf("%s [%s]", msg, strings.Join(problems[msg], ", ")))
+	}
+
+	return result
+}
+
+// Validate checks the package rules (built-in and manifest) of every image
+// in the validation matrix for duplicate packages, packages both installed
+// and removed, packages from repos that are not configured and build repos
+// no package needs
+func (a *Atomic) Validate(ctx context.Context) (string, error) {
+	set, err := a.packageSet(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	problems := validatePackageSet(set)
+	if len(problems) > 0 {
+		return "", errors.New("invalid package rules:\n  " + strings.Join(problems, "\n  "))
+	}
+
+	return "package rules are valid", nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDefaultPackageSet(t *testing.T) {
+	t.Parallel()
+
+	if problems := validatePackageSet(defaultPackageSet()); len(problems) > 0 {
+		t.Fatalf("built-in package rules are invalid:\n  %s", strings.Join(problems, "\n  "))
+	}
+}
+
+func TestValidatePackageSet(t *testing.T) {
+	t.Parallel()
+
+	const (
+		coprURL = "https://copr.fedorainfracloud.org/coprs/foo/bar/repo/fedora-FEDORA_MAJOR_VERSION/foo-bar-fedora-FEDORA_MAJOR_VERSION.repo"
+		unused  = "https://example.com/unused.repo"
+	)
+
+	tests := []struct {
+		name string
+		set  *packageSet
+		want []string
+	}{
+		{
+			name: "valid",
+			set: &packageSet{
+				ReposForBuild: []rule{{Items: []string{coprURL}}},
+				PackagesInstalled: []rule{
+					{Items: []string{"fish"}},
+					{Repo: "copr:foo/bar", Items: []string{"bar"}},
+				},
+				PackagesRemoved: []rule{{Items: []string{"opensc"}}},
+			},
+		},
+		{
+			name: "duplicate package",
+			set: &packageSet{
+				PackagesInstalled: []rule{
+					{Items: []string{"fish"}},
+					{When: "variant == niri && version >= 44", Items: []string{"fish"}},
+				},
+			},
+			want: []string{
+				`package "fish" is installed more than once: "all" (built-in) and "variant == niri && version >= 44" (built-in)`,
+				"[niri-main-44-x86_64, niri-main-44-aarch64, niri-nvidia-44-x86_64, niri-nvidia-44-aarch64]",
+			},
+		},
+		{
+			name: "installed and removed",
+			set: &packageSet{
+				PackagesInstalled: []rule{{Items: []string{"opensc"}}},
+				PackagesRemoved:   []rule{{When: "nvidia", Items: []string{"opensc"}}},
+			},
+			want: []string{
+				`package "opensc" is both installed by "all" (built-in) and removed by "nvidia" (built-in)`,
+			},
+		},
+		{
+			name: "repo not configured",
+			set: &packageSet{
+				ReposForBuild:     []rule{{When: "niri", Items: []string{coprURL}}},
+				PackagesInstalled: []rule{{Repo: "copr:foo/bar", Items: []string{"bar"}}},
+			},
+			want: []string{
+				`package "bar" needs repo "copr:foo/bar" which is not configured [silverblue-main-43-x86_64`,
+			},
+		},
+		{
+			name: "repo not needed",
+			set: &packageSet{
+				ReposForBuild: []rule{{Items: []string{unused}}},
+				ReposForImage: []rule{{Items: []string{"https://example.com/layering.repo"}}},
+			},
+			want: []string{
+				`repo "unused" in reposForBuild is not needed by any package`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			problems := validatePackageSet(tt.set)
+			got := strings.Join(problems, "\n")
+
+			if len(tt.want) == 0 && len(problems) > 0 {
+				t.Fatalf("validatePackageSet() = %v, want no problems", problems)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Fatalf("validatePackageSet() = %q, want it to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRepoID(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"https://copr.fedorainfracloud.org/coprs/yalter/niri/repo/fedora-FEDORA_MAJOR_VERSION/yalter-niri-fedora-FEDORA_MAJOR_VERSION.repo": "copr:yalter/niri",
+		"https://copr.fedorainfracloud.org/coprs/scottames/zen-browser/repo/fedora-43/scottames-zen-browser-fedora-43.repo":                 "copr:scottames/zen-browser",
+		"https://pkgs.tailscale.com/stable/fedora/tailscale.repo":                                                                           "tailscale",
+	}
+
+	for url, want := range tests {
+		if got := repoID(url); got != want {
+			t.Errorf("repoID(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"dagger/atomic/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// VerifyResult is the cosign verification result of an image reference
+type VerifyResult struct {
+	// Image reference or digest as given
+	Ref string
+	// Verified is true if at least one signature verified against the key
+	Verified bool
+	// Digest is the manifest digest of the verified signatures
+	Digest string
+	// Signatures is the number of verified signatures
+	Signatures int
+	// Message is the cosign error if not verified
+	Message string
+}
+
+// cosignSignature is a verified signature as printed by cosign verify
+type cosignSignature struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// verifyResult returns the result of cosign verify for ref from its exit
+// code and output
+func verifyResult(ref string, exitCode int, stdout, stderr string) *VerifyResult {
+	result := &VerifyResult{Ref: ref}
+
+	if exitCode != 0 {
+		result.Message = lastLine(stderr)
+		if result.Message == "" {
+			result.Message = fmt.Sprintf("cosign verify exited with %d", exitCode)
+		}
+		return result
+	}
+
+	signatures := []cosignSignature{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(stdout)), &signatures); err != nil {
+		result.Message = fmt.Sprintf("unable to parse cosign output: %s", err)
+		return result
+	}
+
+	if len(signatures) == 0 {
+		result.Message = "no signatures verified"
+		return result
+	}
+
+	result.Verified = true
+	result.Signatures = len(signatures)
+	result.Digest = signatures[0].Critical.Image.DockerManifestDigest
+
+	return result
+}
+
+// lastLine returns the last non-empty line of s
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// Verify verifies the cosign signatures of the given image references or
+// digests against the cosign.pub of the source, the key ctrSigningConfig
+// bakes into the image. Each ref gets a result, failures are not an error
+func (a *Atomic) Verify(
+	ctx context.Context,
+	// image references or digests, e.g. ghcr.io/foo/atomic:43
+	refs []string,
+	// public key to verify against instead of cosign.pub of the source
+	// +optional
+	publicKey *dagger.File,
+	// registry url to authenticate to, e.g. ghcr.io
+	// +optional
+	registry string,
+	// registry username
+	// +optional
+	username string,
+	// registry auth password/secret
+	// +optional
+	secret *dagger.Secret,
+	// Docker config
+	// +optional
+	dockerConfig *dagger.File,
+	// registry service bound as "registry", e.g. a local registry:2 service
+	// verified as registry:5000/<image>
+	// +optional
+	registryService *dagger.Service,
+	// allow http and self-signed registries
+	// +optional
+	// +default=false
+	insecureRegistry bool,
+	// skip the transparency log, for signatures not uploaded to Rekor
+	// +optional
+	// +default=false
+	ignoreTlog bool,
+	// Cosign container image to be used to verify the refs
+	// +optional
+	// +default="chainguard/cosign:latest"
+	cosignImage string,
+	// Cosign container image user
+	// +optional
+	// +default="nonroot"
+	cosignUser string,
+) ([]*VerifyResult, error) {
+	if publicKey == nil {
+		publicKey = a.Source.File("cosign.pub")
+	}
+
+	ctr, err := cosignContainer(ctx, cosignOpts{
+		Image:            cosignImage,
+		User:             cosignUser,
+		Registry:         registry,
+		RegistryUsername: username,
+		RegistryPassword: secret,
+		DockerConfig:     dockerConfig,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctr = ctr.
+		WithMountedFile("/cosign/cosign.pub", publicKey).
+		// signatures may change for the same ref, never cache verification
+		WithEnvVariable("VERIFIED_AT", time.Now().String())
+
+	if registryService != nil {
+		ctr = ctr.WithServiceBinding("registry", registryService)
+	}
+
+	args := []string{"cosign", "verify", "--key", "/cosign/cosign.pub", "--output", "json"}
+	if insecureRegistry {
+		args = append(args, "--allow-insecure-registry", "--allow-http-registry")
+	}
+	if ignoreTlog {
+		args = append(args, "--insecure-ignore-tlog=true")
+	}
+
+	results := []*VerifyResult{}
+	for _, ref := range refs {
+		verify := ctr.WithExec(
+			append(args, ref),
+			dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny},
+		)
+
+		exitCode, err := verify.ExitCode(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to verify %s: %w", ref, err)
+		}
+
+		stdout, err := verify.Stdout(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to verify %s: %w", ref, err)
+		}
+
+		stderr, err := verify.Stderr(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to verify %s: %w", ref, err)
+		}
+
+		results = append(results, verifyResult(ref, exitCode, stdout, stderr))
+	}
+
+	return results, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestVerifyResult(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		exitCode int
+		stdout   string
+		stderr   string
+		want     VerifyResult
+	}{
+		{
+			name:     "verified",
+			exitCode: 0,
+			stdout: `[{"critical":{"identity":{"docker-reference":"ghcr.io/foo/atomic"},` +
+				`"image":{"docker-manifest-digest":"sha256:abc"},"type":"cosign container image signature"},` +
+				`"optional":null}]`,
+			stderr: "\nVerification for ghcr.io/foo/atomic:43 --\nThe following checks were performed...\n",
+			want:   VerifyResult{Verified: true, Digest: "sha256:abc", Signatures: 1},
+		},
+		{
+			name:     "no matching signatures",
+			exitCode: 1,
+			stderr:   "Error: no matching signatures: invalid signature\nmain.go:74: error during command execution: no matching signatures\n",
+			want:     VerifyResult{Message: "main.go:74: error during command execution: no matching signatures"},
+		},
+		{
+			name:     "failed without output",
+			exitCode: 2,
+			want:     VerifyResult{Message: "cosign verify exited with 2"},
+		},
+		{
+			name:     "unparsable output",
+			exitCode: 0,
+			stdout:   "not json",
+			want:     VerifyResult{Message: "unable to parse cosign output: invalid character 'o' in literal null (expecting 'u')"},
+		},
+		{
+			name:     "no signatures",
+			exitCode: 0,
+			stdout:   "[]",
+			want:     VerifyResult{Message: "no signatures verified"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tt.want.Ref = "ghcr.io/foo/atomic:43"
+			got := verifyResult(tt.want.Ref, tt.exitCode, tt.stdout, tt.stderr)
+			if *got != tt.want {
+				t.Fatalf("verifyResult() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"dagger/toolbox-fedora/internal/dagger"
+	"slices"
+	"testing"
+)
+
+func TestNewProvenance(t *testing.T) {
+	t.Parallel()
+
+	p := newProvenance(provenanceInput{
+		BaseImage: "registry.fedoraproject.org/fedora-toolbox:43",
+		Plan:      resolvePlan("43", "x86_64"),
+	})
+
+	deps := p.BuildDefinition.ResolvedDependencies
+	if len(deps) != 1 || deps[0].URI != "docker://registry.fedoraproject.org/fedora-toolbox:43" || deps[0].Digest != nil {
+		t.Fatalf("ResolvedDependencies = %v, want only the base image without digest", deps)
+	}
+
+	installed := p.BuildDefinition.InternalParameters["packagesInstalled"].([]string)
+	if !slices.Contains(installed, "fish") {
+		t.Fatalf("InternalParameters.packagesInstalled = %v, want fish", installed)
+	}
+
+	if got := digestRefs([]string{"ghcr.io/foo/fedora-toolbox:43@sha256:abc", "ghcr.io/foo/fedora-toolbox:latest@sha256:abc"}); !slices.Equal(got, []string{"ghcr.io/foo/fedora-toolbox@sha256:abc"}) {
+		t.Fatalf("digestRefs() = %v", got)
+	}
+}
+
+func TestCosignArgs(t *testing.T) {
+	t.Parallel()
+
+	got := cosignArgs(cosignOpts{}, "sign", "--yes", "ghcr.io/foo/bar@sha256:abc")
+	if want := []string{"cosign", "sign", "--yes", "ghcr.io/foo/bar@sha256:abc"}; !slices.Equal(got, want) {
+		t.Fatalf("cosignArgs() = %q, want %q", got, want)
+	}
+
+	got = cosignArgs(
+		cosignOpts{RegistryService: &dagger.Service{}, SkipTlog: true},
+		"attest",
+		"registry:5000/bar@sha256:abc",
+	)
+	want := []string{
+		"cosign", "attest",
+		"--allow-insecure-registry", "--allow-http-registry",
+		"--tlog-upload=false",
+		"registry:5000/bar@sha256:abc",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("cosignArgs() = %q, want %q", got, want)
+	}
+}
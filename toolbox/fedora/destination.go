@@ -0,0 +1,112 @@
+package main
+
+import (
+	"dagger/toolbox-fedora/internal/dagger"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Destination is a registry the image is published to in addition to the
+// registry of the publish arguments, see FedoraToolbox.WithDestination
+type Destination struct {
+	// Registry url, e.g. quay.io
+	Registry string
+	// Namespace within the registry, e.g. an organization
+	Namespace string
+	// Registry username
+	Username string
+	// Registry auth password/secret
+	Secret *dagger.Secret
+	// Tags published to the registry, all published tags if empty
+	Tags []string
+
+	// service is bound as the registry, see registryAuth
+	service *dagger.Service
+}
+
+// PublishedDestination is the image published to a destination
+type PublishedDestination struct {
+	// Registry url, e.g. quay.io
+	Registry string
+	// Digest reference, e.g. quay.io/foo/fedora-toolbox@sha256:...
+	Digest string
+	// References the image was tagged as
+	Refs []string
+	// Cosign signature reference, empty unless signed
+	Signature string
+	// Cosign attestation reference, empty unless attested
+	Attestation string
+}
+
+// WithDestination adds a registry the image is published, and signed, to
+// by Publish and PublishAndSign. The image is built once and pushed to all
+// destinations, e.g. mirrors on quay.io and an internal registry
+func (ft *FedoraToolbox) WithDestination(
+	// registry url, e.g. quay.io
+	registry string,
+	// namespace within the registry, e.g. an organization
+	// +optional
+	namespace string,
+	// registry username
+	// +optional
+	username string,
+	// registry auth password/secret
+	// +optional
+	secret *dagger.Secret,
+	// tags to publish to the registry, a subset of the published tags,
+	// all published tags if empty
+	// +optional
+	tags []string,
+) *FedoraToolbox {
+	ft.Destinations = append(ft.Destinations, &Destination{
+		Registry:  registry,
+		Namespace: namespace,
+		Username:  username,
+		Secret:    secret,
+		Tags:      tags,
+	})
+
+	return ft
+}
+
+// prefix returns the registry and namespace images are published to,
+// e.g. ghcr.io/foo
+func (d *Destination) prefix() string {
+	if d.Namespace == "" {
+		return strings.ToLower(d.Registry)
+	}
+
+	return strings.ToLower(fmt.Sprintf("%s/%s", d.Registry, d.Namespace))
+}
+
+// refs returns the references imageName is published as to the destination
+// given the published tags
+func (d *Destination) refs(imageName string, tags []string) ([]string, error) {
+	if len(d.Tags) == 0 {
+		return publishRefs(d.prefix(), imageName, tags), nil
+	}
+
+	for _, tag := range d.Tags {
+		if !slices.Contains(tags, tag) {
+			return nil, fmt.Errorf(
+				"destination %s: tag %s is not published, published tags: %s",
+				d.prefix(),
+				tag,
+				strings.Join(tags, ", "),
+			)
+		}
+	}
+
+	return publishRefs(d.prefix(), imageName, d.Tags), nil
+}
+
+// auth returns how tool containers authenticate to the destination
+func (d *Destination) auth() registryAuth {
+	return registryAuth{
+		Registry: d.Registry,
+		Username: d.Username,
+		Password: d.Secret,
+		Service:  d.service,
+	}
+}
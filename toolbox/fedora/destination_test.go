@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDestinationRefs(t *testing.T) {
+	t.Parallel()
+
+	tags := []string{"43", "latest"}
+
+	tests := []struct {
+		name        string
+		destination Destination
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name:        "all tags",
+			destination: Destination{Registry: "quay.io", Namespace: "Foo"},
+			want:        []string{"quay.io/foo/fedora-toolbox:43", "quay.io/foo/fedora-toolbox:latest"},
+		},
+		{
+			name:        "tag subset",
+			destination: Destination{Registry: "registry.internal:5000", Tags: []string{"latest"}},
+			want:        []string{"registry.internal:5000/fedora-toolbox:latest"},
+		},
+		{
+			name:        "tag not published",
+			destination: Destination{Registry: "quay.io", Tags: []string{"42"}},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := tt.destination.refs("fedora-toolbox", tags)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("refs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("refs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	want := "docker:\n" +
+		"  ghcr.io/foo:\n      use-sigstore-attachments: true\n" +
+		"  quay.io/foo:\n      use-sigstore-attachments: true\n"
+	got := sigstoreAttachments([]string{"quay.io/foo/fedora-toolbox:43", "ghcr.io/foo/fedora-toolbox:43"})
+	if got != want {
+		t.Errorf("sigstoreAttachments() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"dagger/toolbox-fedora/internal/dagger"
+)
+
+// busyboxImage unpacks image tarballs
+const busyboxImage = "cgr.dev/chainguard/busybox:latest"
+
+// finalize labels the image with its title, the last step before the image
+// leaves the pipeline
+func finalize(ctr *dagger.Container, imageName string) *dagger.Container {
+	return ctr.WithLabel("org.opencontainers.image.title", imageName)
+}
+
+// exportImage returns the finalized image, the signing config is not added as
+// there are no published references
+func (ft *FedoraToolbox) exportImage(
+	ctx context.Context,
+	imageName string,
+) (*dagger.Container, error) {
+	ctr, _, err := ft.container(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return finalize(ctr, imageName), nil
+}
+
+// ociLayout returns the OCI image layout of the image
+func ociLayout(ctr *dagger.Container) *dagger.Directory {
+	tarball := ctr.AsTarball(dagger.ContainerAsTarballOpts{
+		MediaTypes: dagger.ImageMediaTypesOcimediaTypes,
+	})
+
+	return dag.Container().
+		From(busyboxImage).
+		WithMountedFile("/tmp/image.tar", tarball).
+		WithExec([]string{"mkdir", "-p", "/tmp/oci"}).
+		WithExec([]string{"tar", "-xf", "/tmp/image.tar", "-C", "/tmp/oci"}).
+		Directory("/tmp/oci")
+}
+
+// ExportOci returns the Fedora toolbx/distrobox image as an OCI image layout,
+// e.g. for skopeo copy oci:<dir> on an air-gapped machine
+func (ft *FedoraToolbox) ExportOci(
+	ctx context.Context,
+	// name of the image, used as the image title
+	// +optional
+	// +default="fedora-toolbox"
+	imageName string,
+) (*dagger.Directory, error) {
+	ctr, err := ft.exportImage(ctx, imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	return ociLayout(ctr), nil
+}
+
+// ExportArchive returns the Fedora toolbx/distrobox image as a
+// docker-archive, e.g. for podman load
+func (ft *FedoraToolbox) ExportArchive(
+	ctx context.Context,
+	// name of the image, used as the image title
+	// +optional
+	// +default="fedora-toolbox"
+	imageName string,
+) (*dagger.File, error) {
+	ctr, err := ft.exportImage(ctx, imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctr.AsTarball(dagger.ContainerAsTarballOpts{
+		MediaTypes: dagger.ImageMediaTypesDockerMediaTypes,
+	}), nil
+}
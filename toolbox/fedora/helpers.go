@@ -1,6 +1,9 @@
 package main
 
-import "strings"
+import (
+	"dagger/toolbox-fedora/internal/dagger"
+	"strings"
+)
 
 // replaceStringInSlice simple helper to replace a given string in a slice of
 // strings
@@ -14,3 +17,21 @@ func replaceStringInSlice(ss []string, replace string, with string) []string {
 
 	return result
 }
+
+// archFromPlatform returns the rpm architecture of the given platform,
+// e.g. linux/amd64 => x86_64
+func archFromPlatform(platform dagger.Platform) string {
+	parts := strings.Split(string(platform), "/")
+	if len(parts) < 2 {
+		return string(platform)
+	}
+
+	switch parts[1] {
+	case "amd64":
+		return "x86_64"
+	case "arm64":
+		return "aarch64"
+	}
+
+	return parts[1]
+}
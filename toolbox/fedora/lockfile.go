@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"dagger/toolbox-fedora/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// A lockfile pins every package the build adds to (or changes in) the base
+// image, so a build can be repeated with exactly the same NEVRAs. The base
+// image itself is recorded but not pinned.
+
+const (
+	lockfileVersion = 1
+	// lockedRule is the rule of packages installed from a lockfile
+	lockedRule = "lockfile"
+	// commandLineRepo is the repo of packages installed from a url
+	commandLineRepo = "@commandline"
+	// rpmQueryFormat is the rpm query format parsed by parseRPMPackages
+	rpmQueryFormat = `%{NAME}\t%{EPOCHNUM}\t%{VERSION}\t%{RELEASE}\t%{ARCH}\t%{SHA256HEADER}\n`
+	// repoQueryFormat is the dnf repoquery format parsed by parseRPMRepos
+	repoQueryFormat = `%{name}.%{arch}\t%{from_repo}\n`
+)
+
+// lockedPackage is an installed package as recorded in a lockfile
+type lockedPackage struct {
+	Name    string `json:"name"`
+	Epoch   string `json:"epoch"`
+	Version string `json:"version"`
+	Release string `json:"release"`
+	Arch    string `json:"arch"`
+	// Repo is the repo the package was installed from, if known
+	Repo string `json:"repo,omitempty"`
+	// Checksum is the sha256 digest of the rpm header
+	Checksum string `json:"checksum"`
+}
+
+// key identifies the package independent of its version, e.g. fish.x86_64
+func (p lockedPackage) key() string {
+	return fmt.Sprintf("%s.%s", p.Name, p.Arch)
+}
+
+// evr returns the [epoch:]version-release of the package
+func (p lockedPackage) evr() string {
+	if p.Epoch == "" || p.Epoch == "0" {
+		return fmt.Sprintf("%s-%s", p.Version, p.Release)
+	}
+
+	return fmt.Sprintf("%s:%s-%s", p.Epoch, p.Version, p.Release)
+}
+
+// nevra returns the package spec installing exactly this package,
+// e.g. fish-3.7.1-5.fc43.x86_64
+func (p lockedPackage) nevra() string {
+	return fmt.Sprintf("%s-%s.%s", p.Name, p.evr(), p.Arch)
+}
+
+// nevraName returns the package name of a package spec returned by nevra,
+// e.g. fish-3.7.1-5.fc43.x86_64 => fish
+func nevraName(nevra string) string {
+	name := nevra
+	// .arch, then -release and -[epoch:]version
+	for _, sep := range []string{".", "-", "-"} {
+		if i := strings.LastIndex(name, sep); i >= 0 {
+			name = name[:i]
+		}
+	}
+
+	return name
+}
+
+// lockfile is the serialized lockfile, see FedoraToolbox.Lock
+type lockfile struct {
+	Version        int             `json:"version"`
+	Image          string          `json:"image"`
+	ReleaseVersion string          `json:"releaseVersion"`
+	Arch           string          `json:"arch"`
+	BaseImage      string          `json:"baseImage"`
+	Packages       []lockedPackage `json:"packages"`
+}
+
+// parseLockfile parses and validates the lockfile at path
+func parseLockfile(path string, data []byte) (*lockfile, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	lock := &lockfile{}
+	if err := dec.Decode(lock); err != nil {
+		return nil, fmt.Errorf("%s: unable to parse lockfile: %w", path, err)
+	}
+
+	if lock.Version != lockfileVersion {
+		return nil, fmt.Errorf("%s: unsupported lockfile version %d (expected %d)",
+			path, lock.Version, lockfileVersion)
+	}
+
+	for i, p := range lock.Packages {
+		if p.Name == "" || p.Version == "" || p.Release == "" || p.Arch == "" {
+			return nil, fmt.Errorf("%s: package %d must have a name, version, release and arch",
+				path, i+1)
+		}
+	}
+
+	return lock, nil
+}
+
+// parseRPMPackages parses the output of rpm -qa --queryformat rpmQueryFormat,
+// skipping the gpg-pubkey pseudo packages
+func parseRPMPackages(out string) ([]lockedPackage, error) {
+	packages := []lockedPackage{}
+	for i, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("unexpected rpm output on line %d: %q", i+1, line)
+		}
+
+		if fields[0] == "gpg-pubkey" {
+			continue
+		}
+
+		p := lockedPackage{
+			Name:     fields[0],
+			Epoch:    fields[1],
+			Version:  fields[2],
+			Release:  fields[3],
+			Arch:     fields[4],
+			Checksum: fields[5],
+		}
+		if p.Checksum == "(none)" {
+			p.Checksum = ""
+		}
+
+		packages = append(packages, p)
+	}
+
+	return packages, nil
+}
+
+// parseRPMRepos parses the output of dnf repoquery --installed --queryformat
+// repoQueryFormat into a map of package key to repo
+func parseRPMRepos(out string) map[string]string {
+	repos := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		key, repo, found := strings.Cut(strings.TrimSpace(line), "\t")
+		if found && repo != "" {
+			repos[key] = repo
+		}
+	}
+
+	return repos
+}
+
+// changedPackages returns the packages of built that are not in base or
+// differ from it, sorted by key
+func changedPackages(base, built []lockedPackage) []lockedPackage {
+	before := map[string]lockedPackage{}
+	for _, p := range base {
+		before[p.key()] = p
+	}
+
+	changed := []lockedPackage{}
+	for _, p := range built {
+		if b, ok := before[p.key()]; ok && b.evr() == p.evr() {
+			continue
+		}
+		changed = append(changed, p)
+	}
+
+	slices.SortFunc(changed, func(a, b lockedPackage) int {
+		return cmp.Compare(a.key(), b.key())
+	})
+
+	return changed
+}
+
+// lockDrift returns a description of every difference between the locked
+// packages and the packages changed by the build
+func lockDrift(locked, changed []lockedPackage) []string {
+	installed := map[string]lockedPackage{}
+	for _, p := range changed {
+		installed[p.key()] = p
+	}
+
+	drift := []string{}
+	for _, want := range locked {
+		have, ok := installed[want.key()]
+		delete(installed, want.key())
+
+		switch {
+		case !ok:
+			drift = append(drift, fmt.Sprintf("%s: locked %s, not installed",
+				want.key(), want.evr()))
+		case have.evr() != want.evr():
+			drift = append(drift, fmt.Sprintf("%s: locked %s, installed %s",
+				want.key(), want.evr(), have.evr()))
+		case want.Checksum != "" && have.Checksum != want.Checksum:
+			drift = append(drift, fmt.Sprintf("%s: checksum %s does not match locked %s",
+				want.key(), have.Checksum, want.Checksum))
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(installed)) {
+		drift = append(drift, fmt.Sprintf("%s: installed %s, not locked",
+			key, installed[key].evr()))
+	}
+
+	return drift
+}
+
+// queryRPMPackages returns the packages installed in the container
+func queryRPMPackages(ctx context.Context, ctr *dagger.Container) ([]lockedPackage, error) {
+	out, err := ctr.
+		WithExec([]string{"rpm", "-qa", "--queryformat", rpmQueryFormat}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query installed packages: %w", err)
+	}
+
+	packages, err := parseRPMPackages(out)
+	if err != nil {
+		return nil, err
+	}
+
+	// the repo is informational, dnf does not know it for every package
+	out, _ = ctr.
+		WithExec([]string{"sh", "-c", fmt.Sprintf(
+			"dnf repoquery --installed --queryformat '%s' 2>/dev/null || true",
+			repoQueryFormat,
+		)}).
+		Stdout(ctx)
+
+	repos := parseRPMRepos(out)
+	for i := range packages {
+		packages[i].Repo = repos[packages[i].key()]
+	}
+
+	return packages, nil
+}
+
+// lockfilePath returns the path of the lockfile for the given plan, relative
+// to Source
+func lockfilePath(plan *buildPlan) string {
+	return fmt.Sprintf("toolbox/fedora/locks/%s-%s-%s.lock.json",
+		plan.Image, plan.ReleaseVersion, plan.Arch)
+}
+
+// lockfile reads the lockfile for the given plan from Source
+func (ft *FedoraToolbox) lockfile(ctx context.Context, plan *buildPlan) (*lockfile, error) {
+	path := lockfilePath(plan)
+
+	found, err := ft.Source.Glob(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read lockfile: %w", err)
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no lockfile at %s, run lock to create it", path)
+	}
+
+	data, err := ft.Source.File(path).Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read lockfile: %w", err)
+	}
+
+	lock, err := parseLockfile(path, []byte(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if lock.Image != plan.Image || lock.ReleaseVersion != plan.ReleaseVersion ||
+		lock.Arch != plan.Arch {
+		return nil, fmt.Errorf("%s: lockfile is for %s-%s-%s",
+			path, lock.Image, lock.ReleaseVersion, lock.Arch)
+	}
+
+	return lock, nil
+}
+
+// lockPlan replaces the packages installed by the plan with the exact
+// versions of the lockfile. Packages installed from urls are kept as they
+// provide repos, swapped packages are left to the swap transaction - both are
+// still verified against the lockfile
+func lockPlan(plan *buildPlan, lock *lockfile) {
+	swapped := map[string]bool{}
+	for _, swap := range plan.PackagesSwapped {
+		swapped[swap.To] = true
+	}
+
+	installed := slices.DeleteFunc(plan.PackagesInstalled, func(p plannedPackage) bool {
+		return !strings.Contains(p.Name, "://")
+	})
+	for _, p := range lock.Packages {
+		if p.Repo == commandLineRepo || swapped[p.Name] {
+			continue
+		}
+		installed = append(installed, plannedPackage{Name: p.nevra(), Rule: lockedRule})
+	}
+
+	plan.PackagesInstalled = installed
+}
+
+// verifyLock fails if the packages changed by the build differ from the
+// lockfile
+func verifyLock(
+	ctx context.Context,
+	base, built *dagger.Container,
+	lock *lockfile,
+	path string,
+) error {
+	before, err := queryRPMPackages(ctx, base)
+	if err != nil {
+		return err
+	}
+
+	after, err := queryRPMPackages(ctx, built)
+	if err != nil {
+		return err
+	}
+
+	drift := lockDrift(lock.Packages, changedPackages(before, after))
+	if len(drift) > 0 {
+		return fmt.Errorf("installed packages drifted from %s:\n  %s",
+			path, strings.Join(drift, "\n  "))
+	}
+
+	return nil
+}
+
+// Lock resolves the package set for the image and tag, installs it and
+// returns a directory containing the resulting lockfile at its path relative
+// to the source, e.g.
+//
+//	dagger call ... lock export --path .
+func (ft *FedoraToolbox) Lock(ctx context.Context) (*dagger.Directory, error) {
+	fedora, plan, err := ft.plan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := queryRPMPackages(ctx, fedora.Container())
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := queryRPMPackages(ctx, build(fedora, plan))
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &lockfile{
+		Version:        lockfileVersion,
+		Image:          plan.Image,
+		ReleaseVersion: plan.ReleaseVersion,
+		Arch:           plan.Arch,
+		BaseImage:      plan.BaseImage,
+		Packages:       changedPackages(before, after),
+	}
+
+	out, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode lockfile: %w", err)
+	}
+
+	return dag.Directory().WithNewFile(lockfilePath(plan), string(out)+"\n"), nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLockPlan(t *testing.T) {
+	t.Parallel()
+
+	plan := resolvePlan("43", "x86_64")
+	lock := &lockfile{
+		Packages: []lockedPackage{
+			{Name: "fish", Epoch: "0", Version: "3.7.1", Release: "5.fc43", Arch: "x86_64", Repo: "fedora"},
+			{Name: "session-manager-plugin", Epoch: "0", Version: "1.2", Release: "1", Arch: "x86_64", Repo: commandLineRepo},
+			{Name: "mesa-va-drivers-freeworld", Epoch: "0", Version: "25.1", Release: "1", Arch: "x86_64", Repo: "rpmfusion-free"},
+		},
+	}
+
+	lockPlan(plan, lock)
+
+	got := []string{}
+	for _, p := range plan.PackagesInstalled {
+		got = append(got, p.Name)
+	}
+
+	want := []string{
+		"https://s3.amazonaws.com/session-manager-downloads/plugin/latest/linux_64bit/session-manager-plugin.rpm",
+		"https://download1.rpmfusion.org/nonfree/fedora/rpmfusion-nonfree-release-43.noarch.rpm",
+		"https://download1.rpmfusion.org/free/fedora/rpmfusion-free-release-43.noarch.rpm",
+		"fish-3.7.1-5.fc43.x86_64",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("PackagesInstalled = %q, want %q", got, want)
+	}
+}
@@ -5,7 +5,8 @@ package main
 import (
 	"context"
 	"dagger/toolbox-fedora/internal/dagger"
-	"fmt"
+	"maps"
+	"slices"
 )
 
 var (
@@ -98,20 +99,45 @@ var (
 		// for fabric: https://github.com/danielmiessler/fabric
 		"gcc-c++",
 		"python3-devel",
-
-		"https://s3.amazonaws.com/session-manager-downloads/plugin/latest/linux_64bit/session-manager-plugin.rpm",
+	}
+	// packageUrlsByArch are the rpms downloaded per rpm architecture
+	packageUrlsByArch = map[string][]string{
+		"x86_64": {
+			"https://s3.amazonaws.com/session-manager-downloads/plugin/latest/linux_64bit/session-manager-plugin.rpm",
+		},
+		"aarch64": {
+			"https://s3.amazonaws.com/session-manager-downloads/plugin/latest/linux_arm64/session-manager-plugin.rpm",
+		},
 	}
 )
 
 type FedoraToolbox struct {
+	Source *dagger.Directory
+
 	Registry       string
 	Org            *string
 	Image          string
 	Suffix         *string
 	Tag            string
 	ReleaseVersion string
+	// rpm architecture, e.g. x86_64
+	Arch string
 
 	Digests []string
+	// Digest reference of the published image, e.g. ghcr.io/foo/bar@sha256:...
+	Digest string
+	// References the published image was tagged as
+	PublishedRefs []string
+	// Published image per destination, the publish arguments first
+	Published []*PublishedDestination
+	// Registries published to in addition to the publish arguments, see
+	// FedoraToolbox.WithDestination
+	Destinations []*Destination
+	// SBOM of the published image, see FedoraToolbox.Sbom
+	PublishedSbom *dagger.Directory
+
+	// Flags
+	Locked bool
 }
 
 func New(
@@ -132,8 +158,20 @@ func New(
 	suffix *string,
 	// Tag or major release version
 	tag string,
+	// Git repository root directory, lockfiles are read from
+	// toolbox/fedora/locks
+	// +optional
+	// +defaultPath="/"
+	source *dagger.Directory,
+	// Install exactly the package versions of the lockfile and fail on
+	// drift, see FedoraToolbox.Lock
+	// +optional
+	// +default=false
+	locked bool,
 ) *FedoraToolbox {
 	return &FedoraToolbox{
+		Source:   source,
+		Locked:   locked,
 		Registry: registry,
 		Org:      org,
 		Image:    image,
@@ -169,38 +207,62 @@ func (ft *FedoraToolbox) fedora(ctx context.Context) *dagger.Fedora {
 	return fedora
 }
 
-// Container returns the Fedora toolbx/distrobox dagger.Container
+// Container returns the Fedora toolbx/distrobox dagger.Container, in locked
+// mode the packages of the lockfile are installed and the resulting container
+// is verified against it
 func (ft *FedoraToolbox) Container(ctx context.Context) (*dagger.Container, error) {
-	fedora := ft.fedora(ctx)
+	ctr, _, err := ft.container(ctx)
+
+	return ctr, err
+}
+
+// container returns the built container and the plan it was built from
+func (ft *FedoraToolbox) container(ctx context.Context) (*dagger.Container, *buildPlan, error) {
+	fedora, plan, err := ft.plan(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	for n, v := range labels {
-		fedora = fedora.WithLabel(n, v)
+	if !ft.Locked {
+		return build(fedora, plan), plan, nil
 	}
 
-	for _, s := range packageUrlsWithReleaseVersion {
-		packages = append(packages, fmt.Sprintf(s, ft.ReleaseVersion))
+	lock, err := ft.lockfile(ctx, plan)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	finalReposForBuild := replaceStringInSlice(
-		reposForBuild,
-		"FEDORA_MAJOR_VERSION",
-		ft.ReleaseVersion,
-	)
+	lockPlan(plan, lock)
+
+	ctr := build(fedora, plan)
+	if err := verifyLock(ctx, fedora.Container(), ctr, lock, lockfilePath(plan)); err != nil {
+		return nil, nil, err
+	}
+
+	return ctr, plan, nil
+}
+
+// build applies the given plan to the base Fedora object
+func build(fedora *dagger.Fedora, plan *buildPlan) *dagger.Container {
+	for _, n := range slices.Sorted(maps.Keys(plan.Labels)) {
+		fedora = fedora.WithLabel(n, plan.Labels[n])
+	}
+
+	installed := []string{}
+	for _, p := range plan.PackagesInstalled {
+		installed = append(installed, p.Name)
+	}
 
 	fedora = fedora.
-		WithPackagesInstalled(packages).
-		WithPackageGroupsInstalled(packageGroups).
-		WithReposFromUrls(finalReposForBuild, false) // false => delete repo file in final image
+		WithPackagesInstalled(installed).
+		WithPackageGroupsInstalled(plan.PackageGroupsInstalled).
+		WithReposFromUrls(plan.ReposForBuild, false) // false => delete repo file in final image
 
-	if hasCompatibleMesaFreeworldDrivers(ft.ReleaseVersion) {
-		fedora = fedora.
-			WithPackagesSwapped("mesa-va-drivers", "mesa-va-drivers-freeworld").
-			WithPackagesSwapped("mesa-vdpau-drivers", "mesa-vdpau-drivers-freeworld")
+	for _, swap := range plan.PackagesSwapped {
+		fedora = fedora.WithPackagesSwapped(swap.From, swap.To)
 	}
 
-	ctr := fedora.
+	return fedora.
 		Container(). // ✨ type becomes dagger.Container here!
 		WithExec([]string{"dnf", "clean", "all"})
-
-	return ctr, nil
 }
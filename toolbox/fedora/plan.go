@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"dagger/toolbox-fedora/internal/dagger"
+	"encoding/json"
+	"fmt"
+)
+
+// plannedPackage is a resolved package and the rule that contributed it
+type plannedPackage struct {
+	Name string `json:"name"`
+	Rule string `json:"rule"`
+}
+
+// packageSwap is a package replaced by another
+type packageSwap struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// buildPlan is everything Container will do for a given image and tag
+type buildPlan struct {
+	Image          string `json:"image"`
+	Tag            string `json:"tag"`
+	Arch           string `json:"arch"`
+	BaseImage      string `json:"baseImage"`
+	ReleaseVersion string `json:"releaseVersion"`
+
+	ReposForBuild          []string         `json:"reposForBuild"`
+	PackagesInstalled      []plannedPackage `json:"packagesInstalled"`
+	PackageGroupsInstalled []string         `json:"packageGroupsInstalled"`
+	PackagesSwapped        []packageSwap    `json:"packagesSwapped"`
+
+	Labels map[string]string `json:"labels"`
+	Tags   []string          `json:"tags"`
+}
+
+// resolvePlan resolves the packages, repos and labels for the given release
+// version and rpm architecture
+func resolvePlan(releaseVersion, arch string) *buildPlan {
+	plan := &buildPlan{
+		ReleaseVersion: releaseVersion,
+		Arch:           arch,
+		ReposForBuild: replaceStringInSlice(
+			reposForBuild,
+			"FEDORA_MAJOR_VERSION",
+			releaseVersion,
+		),
+		PackagesInstalled:      []plannedPackage{},
+		PackageGroupsInstalled: packageGroups,
+		PackagesSwapped:        []packageSwap{},
+		Labels:                 map[string]string{},
+		Tags:                   []string{releaseVersion},
+	}
+
+	for _, p := range packages {
+		plan.PackagesInstalled = append(plan.PackagesInstalled,
+			plannedPackage{Name: p, Rule: "packages"},
+		)
+	}
+
+	for _, u := range packageUrlsByArch[arch] {
+		plan.PackagesInstalled = append(plan.PackagesInstalled,
+			plannedPackage{Name: u, Rule: "packageUrlsByArch"},
+		)
+	}
+
+	for _, s := range packageUrlsWithReleaseVersion {
+		plan.PackagesInstalled = append(plan.PackagesInstalled, plannedPackage{
+			Name: fmt.Sprintf(s, releaseVersion),
+			Rule: "packageUrlsWithReleaseVersion",
+		})
+	}
+
+	if hasCompatibleMesaFreeworldDrivers(releaseVersion) {
+		plan.PackagesSwapped = append(plan.PackagesSwapped,
+			packageSwap{From: "mesa-va-drivers", To: "mesa-va-drivers-freeworld"},
+			packageSwap{From: "mesa-vdpau-drivers", To: "mesa-vdpau-drivers-freeworld"},
+		)
+	}
+
+	for n, v := range labels {
+		plan.Labels[n] = v
+	}
+
+	return plan
+}
+
+// plan resolves the build plan without running any package transactions,
+// returning the base Fedora object the plan is applied to
+func (ft *FedoraToolbox) plan(ctx context.Context) (*dagger.Fedora, *buildPlan, error) {
+	platform, err := ft.platform(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fedora := ft.fedora(ctx)
+	ft.Arch = archFromPlatform(platform)
+
+	plan := resolvePlan(ft.ReleaseVersion, ft.Arch)
+	plan.Image = ft.Image
+	plan.Tag = ft.Tag
+
+	// the base image is informational, ignore lookup errors
+	plan.BaseImage, _ = fedora.BaseImage(ctx)
+
+	return fedora, plan, nil
+}
+
+// ResolvePlan returns the fully resolved build plan as JSON: base image,
+// repos, packages (annotated with the rule that contributed them), labels and
+// tags - without running any package transactions
+func (ft *FedoraToolbox) ResolvePlan(ctx context.Context) (string, error) {
+	_, plan, err := ft.plan(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("unable to encode plan: %w", err)
+	}
+
+	return string(out), nil
+}
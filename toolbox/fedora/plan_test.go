@@ -0,0 +1,77 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolvePlan(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		releaseVersion string
+		arch           string
+		wantSwaps      int
+		wantURL        string
+	}{
+		{
+			name:           "fedora 43 swaps freeworld mesa drivers",
+			releaseVersion: "43",
+			arch:           "x86_64",
+			wantSwaps:      2,
+			wantURL:        "https://s3.amazonaws.com/session-manager-downloads/plugin/latest/linux_64bit/session-manager-plugin.rpm",
+		},
+		{
+			name:           "fedora 44 keeps fedora mesa drivers",
+			releaseVersion: "44",
+			arch:           "x86_64",
+			wantSwaps:      0,
+			wantURL:        "https://s3.amazonaws.com/session-manager-downloads/plugin/latest/linux_64bit/session-manager-plugin.rpm",
+		},
+		{
+			name:           "aarch64 downloads the arm64 session manager plugin",
+			releaseVersion: "43",
+			arch:           "aarch64",
+			wantSwaps:      2,
+			wantURL:        "https://s3.amazonaws.com/session-manager-downloads/plugin/latest/linux_arm64/session-manager-plugin.rpm",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			plan := resolvePlan(tt.releaseVersion, tt.arch)
+
+			if len(plan.PackagesSwapped) != tt.wantSwaps {
+				t.Fatalf("PackagesSwapped = %v, want %d swaps", plan.PackagesSwapped, tt.wantSwaps)
+			}
+
+			for _, repo := range plan.ReposForBuild {
+				if strings.Contains(repo, "FEDORA_MAJOR_VERSION") {
+					t.Fatalf("repo %q was not resolved to release version %s", repo, tt.releaseVersion)
+				}
+			}
+
+			want := plannedPackage{
+				Name: "https://download1.rpmfusion.org/free/fedora/rpmfusion-free-release-" + tt.releaseVersion + ".noarch.rpm",
+				Rule: "packageUrlsWithReleaseVersion",
+			}
+			if !slices.Contains(plan.PackagesInstalled, want) {
+				t.Fatalf("PackagesInstalled is missing %v", want)
+			}
+
+			url := plannedPackage{Name: tt.wantURL, Rule: "packageUrlsByArch"}
+			if !slices.Contains(plan.PackagesInstalled, url) {
+				t.Fatalf("PackagesInstalled is missing %v", url)
+			}
+
+			wantLen := len(packages) + len(packageUrlsByArch[tt.arch]) + len(packageUrlsWithReleaseVersion)
+			if len(plan.PackagesInstalled) != wantLen {
+				t.Fatalf("PackagesInstalled has %d packages, want %d", len(plan.PackagesInstalled), wantLen)
+			}
+		})
+	}
+}
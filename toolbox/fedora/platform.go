@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"dagger/toolbox-fedora/internal/dagger"
+	"fmt"
+	"slices"
+)
+
+// supportedArches are the rpm architectures images are built for
+var supportedArches = []string{"x86_64", "aarch64"}
+
+// checkArch fails if images cannot be built for platform
+func checkArch(platform dagger.Platform) error {
+	if !slices.Contains(supportedArches, archFromPlatform(platform)) {
+		return fmt.Errorf(
+			"unsupported platform %s, supported architectures: %v",
+			platform,
+			supportedArches,
+		)
+	}
+
+	return nil
+}
+
+// platform returns the platform to build, the engine platform: the fedora
+// dependency builds its containers for the engine platform only, so other
+// platforms can neither be selected nor emulated. Build e.g. aarch64 images
+// on an aarch64 engine
+func (ft *FedoraToolbox) platform(ctx context.Context) (dagger.Platform, error) {
+	engine, err := dag.DefaultPlatform(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := checkArch(engine); err != nil {
+		return "", err
+	}
+
+	return engine, nil
+}
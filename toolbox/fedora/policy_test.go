@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPolicySetRequirements(t *testing.T) {
+	t.Parallel()
+
+	p, err := parsePolicy([]byte(`{
+    "default": [{"type": "insecureAcceptAnything"}],
+    "transports": {
+        "docker-daemon": {"": [{"type": "insecureAcceptAnything"}]}
+    }
+}`))
+	if err != nil {
+		t.Fatalf("parsePolicy() unexpected error: %v", err)
+	}
+
+	p.setRequirements(
+		policyTransportDocker,
+		"ghcr.io/foo/fedora-toolbox",
+		[]policyRequirement{sigstoreSigned("/etc/pki/containers/fedora-toolbox.pub")},
+	)
+
+	got, err := p.encode()
+	if err != nil {
+		t.Fatalf("encode() unexpected error: %v", err)
+	}
+
+	want := `{
+    "default": [
+        {
+            "type": "insecureAcceptAnything"
+        }
+    ],
+    "transports": {
+        "docker": {
+            "ghcr.io/foo/fedora-toolbox": [
+                {
+                    "type": "sigstoreSigned",
+                    "keyPath": "/etc/pki/containers/fedora-toolbox.pub",
+                    "signedIdentity": {
+                        "type": "matchRepository"
+                    }
+                }
+            ]
+        },
+        "docker-daemon": {
+            "": [
+                {
+                    "type": "insecureAcceptAnything"
+                }
+            ]
+        }
+    }
+}
+`
+	if got != want {
+		t.Errorf("encode() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSigningRequirementsMatchPublishedRefs(t *testing.T) {
+	t.Parallel()
+
+	refs := publishRefs("ghcr.io/foo", "fedora-toolbox", []string{"43", "pr-1-43", "latest"})
+	got, err := signingRequirements(refs, "/etc/pki/containers/fedora-toolbox.pub")
+	if err != nil {
+		t.Fatalf("signingRequirements() unexpected error: %v", err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("signingRequirements() = %v, want a single scope", got)
+	}
+	for _, ref := range refs {
+		if _, ok := got[imageRepository(ref)]; !ok {
+			t.Errorf("pushed ref %s has no policy scope in %v", ref, got)
+		}
+	}
+}
@@ -3,10 +3,28 @@ package main
 import (
 	"context"
 	"dagger/toolbox-fedora/internal/dagger"
+	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 )
 
+// publication is what publish built and pushed
+type publication struct {
+	plan      *buildPlan
+	sbom      *sbomDocument
+	startedOn time.Time
+	// destinations in the order of FedoraToolbox.Published
+	destinations []*Destination
+	tags         []string
+	// baseImage is the base image reference including its digest, if known
+	baseImage string
+	// dryRun publications are built but not pushed, the sbom is nil if
+	// only the plan was resolved
+	dryRun bool
+}
+
 // publish builds and publishes the Fedora Atomic container image
 func (ft *FedoraToolbox) publish(
 	ctx context.Context,
@@ -25,6 +43,11 @@ func (ft *FedoraToolbox) publish(
 	// registry auth password/secret
 	// +optional
 	secret *dagger.Secret,
+	// skip adding the signing config requiring cosign signatures of the
+	// published image: cosign.pub, registries.d and policy.json
+	// +optional
+	// +default=false
+	skipSigningConfig bool,
 	// skip namespacing registry with username
 	//   example:
 	//     registry=ghcr.io username=foo
@@ -41,24 +64,63 @@ func (ft *FedoraToolbox) publish(
 	// +optional
 	// +default=false
 	latest bool,
-) (*FedoraToolbox, error) {
-	ctr, err := ft.Container(ctx)
-	if err != nil {
-		return nil, err
-	}
+	// build the image and report what would be published and signed,
+	// validating the registry credentials, without pushing anything
+	// +optional
+	// +default=false
+	dryRun bool,
+	// with dryRun, only resolve the plan instead of building the image
+	// +optional
+	// +default=false
+	dryRunPlanOnly bool,
+	// registry service bound as "registry", pushed to over plain HTTP, see
+	// TestPublish
+	// +optional
+	registryService *dagger.Service,
+) (*publication, error) {
+	startedOn := time.Now()
 
-	if secret != nil {
-		// NOTE: the auth step MUST be bare registry w/o username namespace
-		ctr = ctr.WithRegistryAuth(registry, username, secret)
+	var ctr *dagger.Container
+	var plan *buildPlan
+	var doc *sbomDocument
+	if dryRun && dryRunPlanOnly {
+		var err error
+		_, plan, err = ft.plan(ctx)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		ctr, plan, err = ft.container(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		doc, err = sbom(ctx, ctr, imageName, ft.ReleaseVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		ft.PublishedSbom, err = doc.files()
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	// the publish arguments are the primary destination
+	primary := &Destination{
+		Registry: registry,
+		Username: username,
+		Secret:   secret,
+		service:  registryService,
+	}
 	if !skipRegistryNamespace {
-		registry = strings.ToLower(fmt.Sprintf("%s/%s", registry, username))
+		primary.Namespace = username
 	}
+	destinations := append([]*Destination{primary}, ft.Destinations...)
 
-	ctr = ctr.WithLabel("org.opencontainers.image.title", imageName)
-
-	tags := additionalTags
+	// copy, appending must not write to the backing array of the caller
+	tags := slices.Clone(additionalTags)
 	if !skipDefaultTags {
 		tags = append(tags, ft.ReleaseVersion)
 	}
@@ -66,18 +128,186 @@ func (ft *FedoraToolbox) publish(
 		tags = append(tags, "latest")
 	}
 
-	for _, tag := range tags {
-		digest, err := ctr.Publish(
-			ctx,
-			fmt.Sprintf("%s/%s:%s", registry, imageName, tag),
-		)
+	refs := []string{}
+	destinationRefs := [][]string{}
+	for _, d := range destinations {
+		dRefs, err := d.refs(imageName, tags)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(dRefs) == 0 {
+			return nil, fmt.Errorf("no tags to publish %s/%s as", d.prefix(), imageName)
+		}
+
+		refs = append(refs, dRefs...)
+		destinationRefs = append(destinationRefs, dRefs)
+	}
+
+	if ctr != nil {
+		if !skipSigningConfig {
+			var err error
+			ctr, err = ft.ctrSigningConfig(ctx, ctr, refs, imageName)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ctr = finalize(ctr, imageName)
+	}
+
+	p := &publication{
+		plan:         plan,
+		sbom:         doc,
+		startedOn:    startedOn,
+		destinations: destinations,
+		tags:         tags,
+		baseImage:    baseImageRef(ctx, plan.BaseImage),
+		dryRun:       dryRun,
+	}
+
+	if dryRun {
+		if ctr != nil {
+			if _, err := ctr.Sync(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		for i, d := range destinations {
+			err := checkPushAuth(ctx, d.auth(), imageRepository(destinationRefs[i][0]))
+			if err != nil {
+				return nil, fmt.Errorf("destination %s: %w", d.prefix(), err)
+			}
+
+			ft.PublishedRefs = append(ft.PublishedRefs, destinationRefs[i]...)
+			ft.Published = append(ft.Published, &PublishedDestination{
+				Registry: d.prefix(),
+				Refs:     destinationRefs[i],
+			})
+		}
+
+		return p, nil
+	}
+
+	for _, d := range destinations {
+		if d.Secret == nil {
+			continue
+		}
+
+		// NOTE: the auth step MUST be bare registry w/o username namespace
+		ctr = ctr.WithRegistryAuth(d.Registry, d.Username, d.Secret)
+	}
+
+	// push once per destination, the remaining tags point at the same digest
+	for i, d := range destinations {
+		dRefs := destinationRefs[i]
+
+		published, err := pushImage(ctx, ctr, dRefs[0], d.auth())
+		if err != nil {
+			return nil, err
+		}
+
+		digest, err := canonicalDigest(published)
 		if err != nil {
 			return nil, err
 		}
+
+		if err := tagDigest(ctx, ctr, digest, dRefs[1:], d.auth()); err != nil {
+			return nil, err
+		}
+
+		if ft.Digest == "" {
+			ft.Digest = digest
+		}
 		ft.Digests = append(ft.Digests, digest)
+		ft.PublishedRefs = append(ft.PublishedRefs, dRefs...)
+		ft.Published = append(ft.Published, &PublishedDestination{
+			Registry: d.prefix(),
+			Digest:   digest,
+			Refs:     dRefs,
+		})
+	}
+
+	return p, nil
+}
+
+// baseImageRef returns the base image reference including its digest, the
+// digest is informational, the reference is kept if unavailable
+func baseImageRef(ctx context.Context, baseImage string) string {
+	if baseImage == "" {
+		return ""
+	}
+
+	ref, err := dag.Container().From(baseImage).ImageRef(ctx)
+	if err != nil {
+		return baseImage
 	}
 
-	return ft, nil
+	return ref
+}
+
+// result returns the PublishResult of the publication
+func (ft *FedoraToolbox) result(p *publication) *PublishResult {
+	return &PublishResult{
+		Digest:         ft.Digest,
+		Refs:           ft.PublishedRefs,
+		Tags:           p.tags,
+		Destinations:   ft.Published,
+		BaseImage:      p.baseImage,
+		ReleaseVersion: ft.ReleaseVersion,
+		Sbom:           ft.PublishedSbom,
+		DryRun:         p.dryRun,
+	}
+}
+
+// publishRefs returns the image references the image is published as
+func publishRefs(registry, imageName string, tags []string) []string {
+	refs := []string{}
+	for _, tag := range tags {
+		refs = append(refs, fmt.Sprintf("%s/%s:%s", registry, imageName, tag))
+	}
+
+	return refs
+}
+
+// provenance returns the provenance predicate of the publication
+func (ft *FedoraToolbox) provenance(
+	ctx context.Context,
+	p *publication,
+	registry string,
+	imageName string,
+) ([]byte, error) {
+	org, suffix := "", ""
+	if ft.Org != nil {
+		org = *ft.Org
+	}
+	if ft.Suffix != nil {
+		suffix = *ft.Suffix
+	}
+
+	out, err := json.MarshalIndent(newProvenance(provenanceInput{
+		Revision:  gitRevision(ctx, ft.Source),
+		BaseImage: p.baseImage,
+		Parameters: map[string]any{
+			"registry":      ft.Registry,
+			"org":           org,
+			"image":         ft.Image,
+			"suffix":        suffix,
+			"tag":           ft.Tag,
+			"locked":        ft.Locked,
+			"imageRegistry": registry,
+			"imageName":     imageName,
+		},
+		Plan:       p.plan,
+		Packages:   p.sbom.Components,
+		StartedOn:  p.startedOn,
+		FinishedOn: time.Now(),
+	}), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode provenance: %w", err)
+	}
+
+	return out, nil
 }
 
 // Publish build and publish the Fedora atomic container image
@@ -98,9 +328,8 @@ func (ft *FedoraToolbox) Publish(
 	// registry auth password/secret
 	// +optional
 	secret *dagger.Secret,
-	// skip opinionated ublue-way of setting up signing config
-	//   note: if basing off of ublue, this is already setup,
-	//         but not for the source image
+	// skip adding the signing config requiring cosign signatures of the
+	// published image: cosign.pub, registries.d and policy.json
 	// +optional
 	// +default=false
 	skipSigningConfig bool,
@@ -120,23 +349,36 @@ func (ft *FedoraToolbox) Publish(
 	// +optional
 	// +default=false
 	latest bool,
-) ([]string, error) {
-	_, err := ft.publish(
+	// build the image and report what would be published and signed,
+	// validating the registry credentials, without pushing anything
+	// +optional
+	// +default=false
+	dryRun bool,
+	// with dryRun, only resolve the plan instead of building the image
+	// +optional
+	// +default=false
+	dryRunPlanOnly bool,
+) (*PublishResult, error) {
+	published, err := ft.publish(
 		ctx,
 		registry,
 		imageName,
 		additionalTags,
 		username,
 		secret,
+		skipSigningConfig,
 		skipRegistryNamespace,
 		skipDefaultTags,
 		latest,
+		dryRun,
+		dryRunPlanOnly,
+		nil,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	return ft.Digests, nil
+	return ft.result(published), nil
 }
 
 // PublishAndSign build, publish, and sign (via cosign)
@@ -158,9 +400,8 @@ func (ft *FedoraToolbox) PublishAndSign(
 	// registry auth password/secret
 	// +optional
 	secret *dagger.Secret,
-	// skip opinionated ublue-way of setting up signing config
-	//   note: if basing off of ublue, this is already setup,
-	//         but not for the source image
+	// skip adding the signing config requiring cosign signatures of the
+	// published image: cosign.pub, registries.d and policy.json
 	// +optional
 	// +default=false
 	skipSigningConfig bool,
@@ -195,49 +436,166 @@ func (ft *FedoraToolbox) PublishAndSign(
 	// +optional
 	// +default=false
 	latest bool,
-) ([]string, error) {
-	_, err := ft.publish(
+	// build the image and report what would be published and signed,
+	// validating the registry credentials, without pushing anything
+	// +optional
+	// +default=false
+	dryRun bool,
+	// with dryRun, only resolve the plan instead of building the image
+	// +optional
+	// +default=false
+	dryRunPlanOnly bool,
+	// skip attaching SBOM and provenance attestations
+	// +optional
+	// +default=false
+	skipAttestations bool,
+) (*PublishResult, error) {
+	signer := cosignOpts{
+		Image:            *cosignImage,
+		User:             *cosignUser,
+		PrivateKey:       &cosignPrivateKey,
+		Password:         &cosignPassword,
+		Registry:         registry,
+		RegistryUsername: username,
+		RegistryPassword: secret,
+		DockerConfig:     dockerConfig,
+	}
+
+	// never publish images that cannot be verified against cosign.pub
+	err := checkSigningKey(ctx, signer, ft.Source.File("cosign.pub"))
+	if err != nil {
+		return nil, err
+	}
+
+	published, err := ft.publish(
 		ctx,
 		registry,
 		imageName,
 		additionalTags,
 		username,
 		secret,
+		skipSigningConfig,
 		skipRegistryNamespace,
 		skipDefaultTags,
 		latest,
+		dryRun,
+		dryRunPlanOnly,
+		nil,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	opts := dagger.CosignSignOpts{
-		// Should never be nil due to Dagger setting default values
-		CosignImage: *cosignImage,
-		CosignUser:  *cosignUser,
+	result := ft.result(published)
+	if dryRun {
+		result.wouldSign(!skipAttestations)
+
+		return result, nil
 	}
-	if secret != nil {
-		opts.RegistryUsername = username
-		opts.RegistryPassword = secret
+
+	err = ft.signPublished(ctx, published, result, signer, skipAttestations, registry, imageName)
+	if err != nil {
+		return nil, err
 	}
-	if dockerConfig != nil {
-		opts.DockerConfig = dockerConfig
+
+	return result, nil
+}
+
+// signPublished signs the published digest in each of the destinations with
+// the cosign key of signer and, unless skipAttestations, attests its SBOM and
+// provenance, recording the signatures and attestations in the result
+func (ft *FedoraToolbox) signPublished(
+	ctx context.Context,
+	published *publication,
+	result *PublishResult,
+	signer cosignOpts,
+	skipAttestations bool,
+	registry string,
+	imageName string,
+) error {
+	signers := []cosignOpts{}
+	for _, d := range published.destinations {
+		destinationSigner := signer
+		destinationSigner.Registry = d.Registry
+		destinationSigner.RegistryUsername = d.Username
+		destinationSigner.RegistryPassword = d.Secret
+		destinationSigner.RegistryService = d.service
+		signers = append(signers, destinationSigner)
 	}
 
-	cosignStdout, err := dag.Cosign().Sign(
-		ctx,
-		&cosignPrivateKey,
-		&cosignPassword,
-		ft.Digests,
-		opts,
-	)
+	for i, destinationSigner := range signers {
+		digests := []string{result.Destinations[i].Digest}
+
+		// the cosign module cannot reach a registry service, e.g. the
+		// ephemeral registry of TestPublish, sign from a bound container
+		var err error
+		if destinationSigner.RegistryService != nil {
+			err = sign(ctx, destinationSigner, digests)
+		} else {
+			err = cosignSign(ctx, destinationSigner, digests)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := result.signed(result.Destinations[i]); err != nil {
+			return err
+		}
+	}
+
+	if skipAttestations {
+		return nil
+	}
+
+	provenance, err := ft.provenance(ctx, published, registry, imageName)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	provenanceFile := dag.Directory().
+		WithNewFile("provenance.json", string(provenance)).
+		File("provenance.json")
+
+	for i, destinationSigner := range signers {
+		err := attest(
+			ctx,
+			destinationSigner,
+			[]string{result.Destinations[i].Digest},
+			map[string]*dagger.File{
+				attestSbomType:       ft.PublishedSbom.File(sbomSpdxFile),
+				attestProvenanceType: provenanceFile,
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := result.attested(result.Destinations[i]); err != nil {
+			return err
+		}
 	}
 
-	output := append([]string{"Published:"}, ft.Digests...)
-	output = append(output, "")
-	output = append(output, cosignStdout...)
+	return nil
+}
+
+// cosignSign signs each of the digests with the cosign module
+func cosignSign(ctx context.Context, opts cosignOpts, digests []string) error {
+	signOpts := dagger.CosignSignOpts{
+		CosignImage: opts.Image,
+		CosignUser:  opts.User,
+	}
+	if opts.RegistryPassword != nil {
+		signOpts.RegistryUsername = opts.RegistryUsername
+		signOpts.RegistryPassword = opts.RegistryPassword
+	}
+	if opts.DockerConfig != nil {
+		signOpts.DockerConfig = opts.DockerConfig
+	}
+
+	_, err := dag.Cosign().Sign(ctx, opts.PrivateKey, opts.Password, digests, signOpts)
+	if err != nil {
+		return fmt.Errorf("unable to sign %s: %w", strings.Join(digests, ", "), err)
+	}
 
-	return output, nil
+	return nil
 }
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"dagger/toolbox-fedora/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	// cosign attachment tag suffixes, see cosign triangulate
+	signatureSuffix   = "sig"
+	attestationSuffix = "att"
+)
+
+// PublishResult is the image published by Publish and PublishAndSign
+type PublishResult struct {
+	// Digest reference of the image published to the first destination,
+	// e.g. ghcr.io/foo/fedora-toolbox@sha256:...
+	Digest string
+	// References the image was tagged as in all destinations
+	Refs []string
+	// Tags published
+	Tags []string
+	// Published image per destination, the publish arguments first
+	Destinations []*PublishedDestination
+	// Cosign signature references, empty unless signed
+	Signatures []string
+	// Cosign attestation references, empty unless attested
+	Attestations []string
+	// Base image reference including its digest
+	BaseImage string
+	// Fedora release version, e.g. 43
+	ReleaseVersion string
+	// SBOM of the published image, see FedoraToolbox.Sbom
+	Sbom *dagger.Directory
+	// Nothing was pushed, the destinations have no digest
+	DryRun bool
+	// Repositories the digest would be signed in, dry run only
+	WouldSign []string
+	// Repositories the digest would be attested in, dry run only
+	WouldAttest []string
+}
+
+// publishResultJSON is the JSON encoding of a PublishResult
+type publishResultJSON struct {
+	Digest         string                     `json:"digest"`
+	Refs           []string                   `json:"refs"`
+	Tags           []string                   `json:"tags"`
+	Destinations   []publishedDestinationJSON `json:"destinations"`
+	Signatures     []string                   `json:"signatures"`
+	Attestations   []string                   `json:"attestations"`
+	BaseImage      string                     `json:"baseImage,omitempty"`
+	ReleaseVersion string                     `json:"releaseVersion"`
+	DryRun         bool                       `json:"dryRun,omitempty"`
+	WouldSign      []string                   `json:"wouldSign,omitempty"`
+	WouldAttest    []string                   `json:"wouldAttest,omitempty"`
+}
+
+// publishedDestinationJSON is the JSON encoding of a PublishedDestination
+type publishedDestinationJSON struct {
+	Registry    string   `json:"registry"`
+	Digest      string   `json:"digest,omitempty"`
+	Refs        []string `json:"refs"`
+	Signature   string   `json:"signature,omitempty"`
+	Attestation string   `json:"attestation,omitempty"`
+}
+
+// attachmentRef returns the reference cosign attaches the signature or
+// attestations of digestRef to, e.g. ghcr.io/foo/bar@sha256:abc with suffix
+// sig => ghcr.io/foo/bar:sha256-abc.sig
+func attachmentRef(digestRef, suffix string) (string, error) {
+	_, digest, found := strings.Cut(digestRef, "@")
+	if !found || !strings.Contains(digest, ":") {
+		return "", fmt.Errorf("%s is not a digest reference", digestRef)
+	}
+
+	return fmt.Sprintf(
+		"%s:%s.%s",
+		imageRepository(digestRef),
+		strings.Replace(digest, ":", "-", 1),
+		suffix,
+	), nil
+}
+
+// signed records the cosign signature of the destination
+func (r *PublishResult) signed(d *PublishedDestination) error {
+	ref, err := attachmentRef(d.Digest, signatureSuffix)
+	if err != nil {
+		return err
+	}
+
+	d.Signature = ref
+	r.Signatures = append(r.Signatures, ref)
+
+	return nil
+}
+
+// attested records the cosign attestations of the destination
+func (r *PublishResult) attested(d *PublishedDestination) error {
+	ref, err := attachmentRef(d.Digest, attestationSuffix)
+	if err != nil {
+		return err
+	}
+
+	d.Attestation = ref
+	r.Attestations = append(r.Attestations, ref)
+
+	return nil
+}
+
+// wouldSign records the repositories a dry run would sign, and attest, the
+// digest in
+func (r *PublishResult) wouldSign(attest bool) {
+	for _, d := range r.Destinations {
+		if len(d.Refs) == 0 {
+			continue
+		}
+
+		repository := imageRepository(d.Refs[0])
+		r.WouldSign = append(r.WouldSign, repository)
+		if attest {
+			r.WouldAttest = append(r.WouldAttest, repository)
+		}
+	}
+}
+
+// Json returns the publish result as JSON, e.g. for CI
+func (r *PublishResult) Json() (string, error) {
+	out := publishResultJSON{
+		Digest:         r.Digest,
+		Refs:           nonNil(r.Refs),
+		Tags:           nonNil(r.Tags),
+		Destinations:   []publishedDestinationJSON{},
+		Signatures:     nonNil(r.Signatures),
+		Attestations:   nonNil(r.Attestations),
+		BaseImage:      r.BaseImage,
+		ReleaseVersion: r.ReleaseVersion,
+		DryRun:         r.DryRun,
+		WouldSign:      r.WouldSign,
+		WouldAttest:    r.WouldAttest,
+	}
+
+	for _, d := range r.Destinations {
+		out.Destinations = append(out.Destinations, publishedDestinationJSON{
+			Registry:    d.Registry,
+			Digest:      d.Digest,
+			Refs:        nonNil(d.Refs),
+			Signature:   d.Signature,
+			Attestation: d.Attestation,
+		})
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("unable to encode publish result: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// Directory returns the publish result as result.json and the SBOM of the
+// published image in sbom/, e.g. for CI to keep the SBOM of the image it
+// published and signed without building it again
+func (r *PublishResult) Directory() (*dagger.Directory, error) {
+	data, err := r.Json()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := dag.Directory().WithNewFile("result.json", data+"\n")
+	if r.Sbom != nil {
+		dir = dir.WithDirectory("sbom", r.Sbom)
+	}
+
+	return dir, nil
+}
+
+// Text returns the publish result for humans
+func (r *PublishResult) Text() string {
+	out := &strings.Builder{}
+	for i, d := range r.Destinations {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+
+		if r.DryRun {
+			fmt.Fprintf(out, "Would publish %s:\n\nTagged:\n", d.Registry)
+		} else {
+			fmt.Fprintf(out, "Published %s:\n%s\n\nTagged:\n", d.Registry, d.Digest)
+		}
+		for _, ref := range d.Refs {
+			fmt.Fprintln(out, ref)
+		}
+
+		if d.Signature != "" {
+			fmt.Fprintf(out, "\nSignature:\n%s\n", d.Signature)
+		}
+		if d.Attestation != "" {
+			fmt.Fprintf(out, "\nAttestations:\n%s\n", d.Attestation)
+		}
+	}
+
+	if r.DryRun {
+		out.WriteString("\nDry run, nothing was pushed\n")
+		if len(r.WouldSign) > 0 {
+			fmt.Fprintf(out, "Would sign the digest in: %s\n", strings.Join(r.WouldSign, ", "))
+		}
+		if len(r.WouldAttest) > 0 {
+			fmt.Fprintf(out, "Would attest the digest in: %s\n", strings.Join(r.WouldAttest, ", "))
+		}
+	}
+
+	out.WriteString("\n")
+	if r.BaseImage != "" {
+		fmt.Fprintf(out, "Base image: %s\n", r.BaseImage)
+	}
+	fmt.Fprintf(out, "Release version: %s\n", r.ReleaseVersion)
+
+	return out.String()
+}
+
+// nonNil returns s, an empty slice if nil, so it is encoded as [] not null
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+
+	return s
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPublishResult(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		sign           bool
+		wantSignatures []string
+	}{
+		{
+			name:           "published",
+			wantSignatures: []string{},
+		},
+		{
+			name:           "signed",
+			sign:           true,
+			wantSignatures: []string{"ghcr.io/foo/fedora-toolbox:sha256-abc.sig"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := &PublishResult{
+				Digest: "ghcr.io/foo/fedora-toolbox@sha256:abc",
+				Refs:   []string{"ghcr.io/foo/fedora-toolbox:43"},
+				Tags:   []string{"43"},
+				Destinations: []*PublishedDestination{{
+					Registry: "ghcr.io/foo",
+					Digest:   "ghcr.io/foo/fedora-toolbox@sha256:abc",
+					Refs:     []string{"ghcr.io/foo/fedora-toolbox:43"},
+				}},
+				ReleaseVersion: "43",
+			}
+			if tt.sign {
+				if err := r.signed(r.Destinations[0]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			out, err := r.Json()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded := publishResultJSON{}
+			if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+				t.Fatalf("Json() is not valid JSON: %v\n%s", err, out)
+			}
+			if !slices.Equal(decoded.Signatures, tt.wantSignatures) {
+				t.Errorf("Json() signatures = %v, want %v", decoded.Signatures, tt.wantSignatures)
+			}
+			if decoded.Attestations == nil || decoded.Digest != r.Digest {
+				t.Errorf("Json() = %s", out)
+			}
+
+			text := r.Text()
+			for _, want := range append([]string{"Published ghcr.io/foo:", "Release version: 43"}, tt.wantSignatures...) {
+				if !strings.Contains(text, want) {
+					t.Errorf("Text() does not contain %q:\n%s", want, text)
+				}
+			}
+		})
+	}
+}
+
+func TestPublishResultDryRun(t *testing.T) {
+	t.Parallel()
+
+	r := &PublishResult{
+		Refs: []string{"ghcr.io/foo/fedora-toolbox:43"},
+		Tags: []string{"43"},
+		Destinations: []*PublishedDestination{{
+			Registry: "ghcr.io/foo",
+			Refs:     []string{"ghcr.io/foo/fedora-toolbox:43"},
+		}},
+		ReleaseVersion: "43",
+		DryRun:         true,
+	}
+	r.wouldSign(false)
+
+	if want := []string{"ghcr.io/foo/fedora-toolbox"}; !slices.Equal(r.WouldSign, want) {
+		t.Errorf("WouldSign = %v, want %v", r.WouldSign, want)
+	}
+	if len(r.WouldAttest) != 0 {
+		t.Errorf("WouldAttest = %v, want none", r.WouldAttest)
+	}
+
+	text := r.Text()
+	if !strings.Contains(text, "Would publish ghcr.io/foo:") || strings.Contains(text, "Published") {
+		t.Errorf("Text() =\n%s", text)
+	}
+}
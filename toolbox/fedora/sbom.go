@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"dagger/toolbox-fedora/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	sbomSpdxFile      = "sbom.spdx.json"
+	sbomCycloneDXFile = "sbom.cdx.json"
+	sbomTool          = "scottames-containers-toolbox-fedora"
+	sbomNamespace     = "https://github.com/scottames/containers/sbom"
+	// sbomNoAssertion is the SPDX value for unknown fields
+	sbomNoAssertion = "NOASSERTION"
+	// sbomQueryFormat is the rpm query format parsed by parseSbomPackages
+	sbomQueryFormat = `%{NAME}\t%{EPOCHNUM}\t%{VERSION}\t%{RELEASE}\t%{ARCH}\t%{LICENSE}\t%{VENDOR}\n`
+)
+
+// sbomComponent is a package in the image
+type sbomComponent struct {
+	Name             string
+	Version          string
+	License          string
+	Supplier         string
+	DownloadLocation string
+	Purl             string
+}
+
+// sbomDocument is the inventory of an image, rendered as SPDX or CycloneDX
+type sbomDocument struct {
+	// Name of the image, e.g. fedora-toolbox
+	Name       string
+	Version    string
+	Created    time.Time
+	Components []sbomComponent
+}
+
+// rpmPurl returns the package url of the rpm
+func rpmPurl(p lockedPackage, releaseVersion string) string {
+	query := url.Values{}
+	query.Set("arch", p.Arch)
+	if p.Epoch != "" && p.Epoch != "0" {
+		query.Set("epoch", p.Epoch)
+	}
+	query.Set("distro", "fedora-"+releaseVersion)
+
+	return fmt.Sprintf("pkg:rpm/fedora/%s@%s-%s?%s",
+		url.PathEscape(p.Name), p.Version, p.Release, query.Encode())
+}
+
+// parseSbomPackages parses the output of rpm -qa --queryformat
+// sbomQueryFormat into components, skipping the gpg-pubkey pseudo packages
+func parseSbomPackages(out, releaseVersion string) ([]sbomComponent, error) {
+	components := []sbomComponent{}
+	for i, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("unexpected rpm output on line %d: %q", i+1, line)
+		}
+
+		if fields[0] == "gpg-pubkey" {
+			continue
+		}
+
+		p := lockedPackage{
+			Name:    fields[0],
+			Epoch:   fields[1],
+			Version: fields[2],
+			Release: fields[3],
+			Arch:    fields[4],
+		}
+
+		components = append(components, sbomComponent{
+			Name:             p.Name,
+			Version:          p.evr(),
+			License:          rpmTagValue(fields[5]),
+			Supplier:         rpmTagValue(fields[6]),
+			DownloadLocation: sbomNoAssertion,
+			Purl:             rpmPurl(p, releaseVersion),
+		})
+	}
+
+	return components, nil
+}
+
+// rpmTagValue returns the value of an rpm tag, empty if not set
+func rpmTagValue(value string) string {
+	if value == "(none)" {
+		return ""
+	}
+
+	return value
+}
+
+// marshalSbom encodes v as indented JSON without escaping HTML characters,
+// keeping package urls readable
+func marshalSbom(v any) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// id returns a stable identifier for the document contents
+func (d *sbomDocument) id() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", d.Name, d.Version)
+	for _, c := range d.Components {
+		fmt.Fprintf(h, "%s\n", c.Purl)
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// orNoAssertion returns value, or NOASSERTION if empty
+func orNoAssertion(value string) string {
+	if value == "" {
+		return sbomNoAssertion
+	}
+
+	return value
+}
+
+// spdx renders the document as SPDX 2.3 JSON
+func (d *sbomDocument) spdx() ([]byte, error) {
+	type externalRef struct {
+		ReferenceCategory string `json:"referenceCategory"`
+		ReferenceType     string `json:"referenceType"`
+		ReferenceLocator  string `json:"referenceLocator"`
+	}
+	type pkg struct {
+		SPDXID           string        `json:"SPDXID"`
+		Name             string        `json:"name"`
+		VersionInfo      string        `json:"versionInfo,omitempty"`
+		Supplier         string        `json:"supplier"`
+		DownloadLocation string        `json:"downloadLocation"`
+		FilesAnalyzed    bool          `json:"filesAnalyzed"`
+		LicenseConcluded string        `json:"licenseConcluded"`
+		LicenseDeclared  string        `json:"licenseDeclared"`
+		CopyrightText    string        `json:"copyrightText"`
+		ExternalRefs     []externalRef `json:"externalRefs,omitempty"`
+	}
+	type relationship struct {
+		SpdxElementID      string `json:"spdxElementId"`
+		RelationshipType   string `json:"relationshipType"`
+		RelatedSpdxElement string `json:"relatedSpdxElement"`
+	}
+
+	image := pkg{
+		SPDXID:           "SPDXRef-Image",
+		Name:             d.Name,
+		VersionInfo:      d.Version,
+		Supplier:         sbomNoAssertion,
+		DownloadLocation: sbomNoAssertion,
+		LicenseConcluded: sbomNoAssertion,
+		LicenseDeclared:  sbomNoAssertion,
+		CopyrightText:    sbomNoAssertion,
+	}
+
+	packages := []pkg{image}
+	relationships := []relationship{{
+		SpdxElementID:      "SPDXRef-DOCUMENT",
+		RelationshipType:   "DESCRIBES",
+		RelatedSpdxElement: image.SPDXID,
+	}}
+
+	for i, c := range d.Components {
+		supplier := sbomNoAssertion
+		if c.Supplier != "" {
+			supplier = "Organization: " + c.Supplier
+		}
+
+		p := pkg{
+			SPDXID:           fmt.Sprintf("SPDXRef-Package-%d", i+1),
+			Name:             c.Name,
+			VersionInfo:      c.Version,
+			Supplier:         supplier,
+			DownloadLocation: orNoAssertion(c.DownloadLocation),
+			LicenseConcluded: sbomNoAssertion,
+			LicenseDeclared:  orNoAssertion(c.License),
+			CopyrightText:    sbomNoAssertion,
+			ExternalRefs: []externalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  c.Purl,
+			}},
+		}
+
+		packages = append(packages, p)
+		relationships = append(relationships, relationship{
+			SpdxElementID:      image.SPDXID,
+			RelationshipType:   "CONTAINS",
+			RelatedSpdxElement: p.SPDXID,
+		})
+	}
+
+	return marshalSbom(map[string]any{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              d.Name,
+		"documentNamespace": fmt.Sprintf("%s/%s-%s", sbomNamespace, d.Name, d.id()),
+		"creationInfo": map[string]any{
+			"created":  d.Created.UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: " + sbomTool},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	})
+}
+
+// cycloneDX renders the document as CycloneDX 1.5 JSON
+func (d *sbomDocument) cycloneDX() ([]byte, error) {
+	type license struct {
+		Expression string `json:"expression"`
+	}
+	type supplier struct {
+		Name string `json:"name"`
+	}
+	type component struct {
+		Type     string    `json:"type"`
+		BomRef   string    `json:"bom-ref,omitempty"`
+		Name     string    `json:"name"`
+		Version  string    `json:"version,omitempty"`
+		Supplier *supplier `json:"supplier,omitempty"`
+		Licenses []license `json:"licenses,omitempty"`
+		Purl     string    `json:"purl,omitempty"`
+	}
+
+	components := []component{}
+	for _, c := range d.Components {
+		cc := component{
+			Type:    "library",
+			BomRef:  c.Purl,
+			Name:    c.Name,
+			Version: c.Version,
+			Purl:    c.Purl,
+		}
+		if c.Supplier != "" {
+			cc.Supplier = &supplier{Name: c.Supplier}
+		}
+		if c.License != "" {
+			cc.Licenses = []license{{Expression: c.License}}
+		}
+
+		components = append(components, cc)
+	}
+
+	id := d.id()
+
+	return marshalSbom(map[string]any{
+		"bomFormat":   "CycloneDX",
+		"specVersion": "1.5",
+		"serialNumber": fmt.Sprintf("urn:uuid:%s-%s-%s-%s-%s",
+			id[0:8], id[8:12], id[12:16], id[16:20], id[20:32]),
+		"version": 1,
+		"metadata": map[string]any{
+			"timestamp": d.Created.UTC().Format(time.RFC3339),
+			"tools": map[string]any{
+				"components": []component{{Type: "application", Name: sbomTool}},
+			},
+			"component": component{
+				Type:    "container",
+				Name:    d.Name,
+				Version: d.Version,
+			},
+		},
+		"components": components,
+	})
+}
+
+// files returns a directory containing the SPDX and CycloneDX documents
+func (d *sbomDocument) files() (*dagger.Directory, error) {
+	spdx, err := d.spdx()
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode SPDX SBOM: %w", err)
+	}
+
+	cdx, err := d.cycloneDX()
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode CycloneDX SBOM: %w", err)
+	}
+
+	return dag.Directory().
+		WithNewFile(sbomSpdxFile, string(spdx)+"\n").
+		WithNewFile(sbomCycloneDXFile, string(cdx)+"\n"), nil
+}
+
+// sbom returns the inventory of the rpm database of the built container
+func sbom(
+	ctx context.Context,
+	ctr *dagger.Container,
+	name string,
+	releaseVersion string,
+) (*sbomDocument, error) {
+	out, err := ctr.
+		WithExec([]string{"rpm", "-qa", "--queryformat", sbomQueryFormat}).
+		Stdout(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query installed packages: %w", err)
+	}
+
+	components, err := parseSbomPackages(out, releaseVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sbomDocument{
+		Name:       name,
+		Version:    releaseVersion,
+		Created:    time.Now(),
+		Components: components,
+	}, nil
+}
+
+// Sbom returns a directory containing SPDX (sbom.spdx.json) and CycloneDX
+// (sbom.cdx.json) SBOMs of the built container, listing every installed rpm
+func (ft *FedoraToolbox) Sbom(ctx context.Context) (*dagger.Directory, error) {
+	ctr, err := ft.Container(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := sbom(ctx, ctr, ft.Image, ft.ReleaseVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.files()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSbomPackages(t *testing.T) {
+	t.Parallel()
+
+	out := "fish\t0\t3.7.1\t5.fc43\tx86_64\tGPL-2.0-only\tFedora Project\n" +
+		"gpg-pubkey\t0\tdeadbeef\t1\t(none)\tpubkey\t(none)\n"
+
+	got, err := parseSbomPackages(out, "43")
+	if err != nil {
+		t.Fatalf("parseSbomPackages() unexpected error: %v", err)
+	}
+
+	want := []sbomComponent{{
+		Name:             "fish",
+		Version:          "3.7.1-5.fc43",
+		License:          "GPL-2.0-only",
+		Supplier:         "Fedora Project",
+		DownloadLocation: sbomNoAssertion,
+		Purl:             "pkg:rpm/fedora/fish@3.7.1-5.fc43?arch=x86_64&distro=fedora-43",
+	}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("parseSbomPackages() = %v, want %v", got, want)
+	}
+
+	spdx, err := (&sbomDocument{Name: "fedora-toolbox", Version: "43", Components: got}).spdx()
+	if err != nil {
+		t.Fatalf("spdx() unexpected error: %v", err)
+	}
+	if !strings.Contains(string(spdx), want[0].Purl) {
+		t.Fatalf("spdx() is missing %s", want[0].Purl)
+	}
+}
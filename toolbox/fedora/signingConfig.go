@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"dagger/toolbox-fedora/internal/dagger"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// sigstoreAttachments returns the registries.d config enabling sigstore
+// attachments for the registry namespaces of the refs, e.g. ghcr.io/foo
+func sigstoreAttachments(refs []string) string {
+	config := &strings.Builder{}
+	config.WriteString("docker:\n")
+
+	namespaces := []string{}
+	for _, scope := range policyScopes(refs) {
+		if namespace := path.Dir(scope); !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+			fmt.Fprintf(config, "  %s:\n      use-sigstore-attachments: true\n", namespace)
+		}
+	}
+
+	return config.String()
+}
+
+// ctrSigningConfig adds the sigstore signing config of the published image:
+// the cosign.pub of the source, the registries.d sigstore attachments and
+// policy.json entries requiring signatures by the key for the repository of
+// each of the refs to be published
+func (ft *FedoraToolbox) ctrSigningConfig(
+	ctx context.Context,
+	ctr *dagger.Container,
+	refs []string,
+	imageName string,
+) (*dagger.Container, error) {
+	keyPath := fmt.Sprintf("/etc/pki/containers/%s.pub", imageName)
+	registriesD := fmt.Sprintf("/etc/containers/registries.d/%s.yaml", imageName)
+
+	requirements, err := signingRequirements(refs, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := containerPolicy(ctx, ctr)
+	if err != nil {
+		return nil, err
+	}
+
+	for scope, scopeRequirements := range requirements {
+		p.setRequirements(policyTransportDocker, scope, scopeRequirements)
+	}
+
+	policyJSON, err := p.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return ctr.
+		WithFile(keyPath, ft.Source.File("cosign.pub")).
+		WithNewFile(
+			registriesD,
+			sigstoreAttachments(refs),
+			dagger.ContainerWithNewFileOpts{
+				Permissions: 0644,
+				Owner:       "root",
+			}).
+		WithNewFile(
+			policyPath,
+			policyJSON,
+			dagger.ContainerWithNewFileOpts{
+				Permissions: 0644,
+				Owner:       "root",
+			}), nil
+}
+
+// containerPolicy reads the containers policy of the container, the
+// containers-common default if it has none
+func containerPolicy(ctx context.Context, ctr *dagger.Container) (*policy, error) {
+	found, err := ctr.Directory("/etc/containers").Glob(ctx, "policy.json")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", policyPath, err)
+	}
+
+	if len(found) == 0 {
+		return defaultPolicy(), nil
+	}
+
+	data, err := ctr.File(policyPath).Contents(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", policyPath, err)
+	}
+
+	return parsePolicy([]byte(data))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSamePublicKey(t *testing.T) {
+	t.Parallel()
+
+	key := "-----BEGIN PUBLIC KEY-----\n" +
+		"MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE0dkyRzVe6JwbQMo7b6ZgtgxzqiMq\n" +
+		"J2v0McQxWaCJS/+4w/Kjz+ZJLRMFMOuCeMu/dLqMfKnBdnjNxSXRMt8NOg==\n" +
+		"-----END PUBLIC KEY-----\n"
+	other := strings.Replace(key, "0dkyRzVe", "aaaaRzVe", 1)
+
+	tests := []struct {
+		name string
+		b    string
+		want bool
+	}{
+		{name: "same key", b: "\n" + key + "\n", want: true},
+		{name: "different key", b: other, want: false},
+		{name: "not PEM", b: "Error: decryption failed", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := samePublicKey(key, tt.b); got != tt.want {
+				t.Errorf("samePublicKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
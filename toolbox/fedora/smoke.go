@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"dagger/toolbox-fedora/internal/dagger"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// smokeBinary is a binary that must be on the PATH if the package installing
+// it is part of the plan
+type smokeBinary struct {
+	Name    string
+	Package string
+}
+
+// smokeBinaries are the binaries checked by Test
+var smokeBinaries = []smokeBinary{
+	{Name: "fish", Package: "fish"},
+	{Name: "git", Package: "git"},
+	{Name: "mise", Package: "mise"},
+	{Name: "rg", Package: "ripgrep"},
+	{Name: "skopeo", Package: "skopeo"},
+	{Name: "zsh", Package: "zsh"},
+}
+
+// smokeCheck is an assertion run inside the built container, it passes if
+// Args exit 0
+type smokeCheck struct {
+	// Class groups the checks in the JUnit report, e.g. binaries
+	Class string
+	Name  string
+	Args  []string
+}
+
+// bashCheck returns the args running script with bash, the args are passed
+// as $0, $1, ...
+func bashCheck(script string, args ...string) []string {
+	return append([]string{"bash", "-c", script}, args...)
+}
+
+// smokeChecks returns the checks of the plan: the binaries on the PATH, the
+// swapped packages replaced and the build repo files deleted
+func smokeChecks(plan *buildPlan) []smokeCheck {
+	installed := []string{}
+	for _, p := range plan.PackagesInstalled {
+		// locked packages are installed by NEVRA, see lockPlan
+		if p.Rule == lockedRule {
+			installed = append(installed, nevraName(p.Name))
+			continue
+		}
+
+		installed = append(installed, p.Name)
+	}
+
+	checks := []smokeCheck{}
+	for _, binary := range smokeBinaries {
+		if !slices.Contains(installed, binary.Package) {
+			continue
+		}
+
+		checks = append(checks, smokeCheck{
+			Class: "binaries",
+			Name:  binary.Name,
+			Args:  bashCheck(`command -v "$0"`, binary.Name),
+		})
+	}
+
+	for _, swap := range plan.PackagesSwapped {
+		checks = append(checks, smokeCheck{
+			Class: "packagesSwapped",
+			Name:  swap.From,
+			Args:  bashCheck(`! rpm -q "$0" && rpm -q "$1"`, swap.From, swap.To),
+		})
+	}
+
+	for _, repo := range plan.ReposForBuild {
+		name := path.Join("/etc/yum.repos.d", path.Base(repo))
+		checks = append(checks, smokeCheck{
+			Class: "reposForBuild",
+			Name:  name,
+			Args:  []string{"test", "!", "-e", name},
+		})
+	}
+
+	return checks
+}
+
+// smokeResult is the outcome of a smoke check, Output is empty if it passed
+type smokeResult struct {
+	Check  smokeCheck
+	Passed bool
+	Output string
+}
+
+// junitTestSuite is a JUnit XML test suite
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is a JUnit XML test case
+type junitTestCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+// junitFailure is the failure of a JUnit XML test case
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Output  string `xml:",chardata"`
+}
+
+// junitReport returns the JUnit XML report of the results
+func junitReport(suite string, results []smokeResult) (string, error) {
+	report := junitTestSuite{Name: suite, Tests: len(results), TestCases: []junitTestCase{}}
+	for _, result := range results {
+		testCase := junitTestCase{
+			Classname: suite + "." + result.Check.Class,
+			Name:      result.Check.Name,
+		}
+
+		if !result.Passed {
+			report.Failures++
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("%s failed", strings.Join(result.Check.Args, " ")),
+				Output:  result.Output,
+			}
+		}
+
+		report.TestCases = append(report.TestCases, testCase)
+	}
+
+	out, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("unable to encode JUnit report: %w", err)
+	}
+
+	return xml.Header + string(out) + "\n", nil
+}
+
+// runSmokeChecks runs each of the checks in ctr
+func runSmokeChecks(
+	ctx context.Context,
+	ctr *dagger.Container,
+	checks []smokeCheck,
+) ([]smokeResult, error) {
+	results := []smokeResult{}
+	for _, check := range checks {
+		run := ctr.WithExec(check.Args, dagger.ContainerWithExecOpts{Expect: dagger.ReturnTypeAny})
+
+		exitCode, err := run.ExitCode(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to run %s: %w", check.Name, err)
+		}
+
+		result := smokeResult{Check: check, Passed: exitCode == 0}
+		if !result.Passed {
+			stdout, _ := run.Stdout(ctx)
+			stderr, _ := run.Stderr(ctx)
+			result.Output = strings.TrimSpace(stdout + stderr)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// Test runs the smoke checks of the plan inside the built container: binaries
+// on the PATH, swapped packages replaced and build repo files deleted. Returns
+// a JUnit XML report, failed checks are reported, not an error
+func (ft *FedoraToolbox) Test(ctx context.Context) (*dagger.File, error) {
+	ctr, plan, err := ft.container(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := runSmokeChecks(ctx, ctr, smokeChecks(plan))
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := junitReport("fedora-toolbox", results)
+	if err != nil {
+		return nil, err
+	}
+
+	return dag.Directory().
+		WithNewFile("junit.xml", report).
+		File("junit.xml"), nil
+}
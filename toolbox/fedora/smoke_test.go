@@ -0,0 +1,77 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSmokeChecks(t *testing.T) {
+	t.Parallel()
+
+	checks := smokeChecks(&buildPlan{
+		ReposForBuild: []string{
+			"https://copr.fedorainfracloud.org/coprs/scottames/mise/repo/fedora-43/scottames-mise-fedora-43.repo",
+		},
+		PackagesInstalled: []plannedPackage{{Name: "git"}, {Name: "mise"}},
+		PackagesSwapped:   []packageSwap{{From: "mesa-va-drivers", To: "mesa-va-drivers-freeworld"}},
+	})
+
+	names := []string{}
+	for _, check := range checks {
+		names = append(names, check.Class+" "+check.Name)
+	}
+
+	want := []string{
+		"binaries git",
+		"binaries mise",
+		"packagesSwapped mesa-va-drivers",
+		"reposForBuild /etc/yum.repos.d/scottames-mise-fedora-43.repo",
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("smokeChecks() = %v, want %v", names, want)
+	}
+}
+
+func TestSmokeChecksLocked(t *testing.T) {
+	t.Parallel()
+
+	plan := &buildPlan{PackagesInstalled: []plannedPackage{{Name: "git"}, {Name: "ripgrep"}}}
+	lockPlan(plan, &lockfile{Packages: []lockedPackage{
+		{Name: "git", Epoch: "0", Version: "2.51.0", Release: "1.fc43", Arch: "x86_64", Repo: "fedora"},
+		{Name: "git-core", Epoch: "0", Version: "2.51.0", Release: "1.fc43", Arch: "x86_64", Repo: "fedora"},
+		{Name: "ripgrep", Epoch: "0", Version: "14.1.1", Release: "2.fc43", Arch: "x86_64", Repo: "fedora"},
+	}})
+
+	names := []string{}
+	for _, check := range smokeChecks(plan) {
+		names = append(names, check.Class+" "+check.Name)
+	}
+
+	// the locked plan installs NEVRAs, the binaries are still checked
+	if want := []string{"binaries git", "binaries rg"}; !slices.Equal(names, want) {
+		t.Fatalf("smokeChecks() = %v, want %v", names, want)
+	}
+}
+
+func TestJunitReport(t *testing.T) {
+	t.Parallel()
+
+	report, err := junitReport("fedora-toolbox", []smokeResult{
+		{Check: smokeCheck{Class: "binaries", Name: "git", Args: []string{"test"}}, Passed: true},
+		{Check: smokeCheck{Class: "binaries", Name: "mise", Args: []string{"false"}}, Output: "<missing>"},
+	})
+	if err != nil {
+		t.Fatalf("junitReport() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`<testsuite name="fedora-toolbox" tests="2" failures="1">`,
+		`<testcase classname="fedora-toolbox.binaries" name="git"></testcase>`,
+		`<failure message="false failed">&lt;missing&gt;</failure>`,
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("junitReport() = %s, missing %s", report, want)
+		}
+	}
+}
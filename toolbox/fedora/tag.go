@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"dagger/toolbox-fedora/internal/dagger"
+	"fmt"
+	"strings"
+)
+
+const (
+	craneImage = "cgr.dev/chainguard/crane:latest"
+	craneUser  = "nonroot"
+)
+
+// canonicalDigest returns the digest reference of a published image
+// reference, e.g. ghcr.io/foo/bar:43@sha256:... => ghcr.io/foo/bar@sha256:...
+func canonicalDigest(published string) (string, error) {
+	_, digest, found := strings.Cut(published, "@")
+	if !found || digest == "" {
+		return "", fmt.Errorf("published image %s has no digest", published)
+	}
+
+	return imageRepository(published) + "@" + digest, nil
+}
+
+// craneArgs returns the crane command pointing ref at the image digestRef.
+// Within the same repository only the tag is added, otherwise the image is
+// copied, blobs already present are not uploaded again
+func craneArgs(digestRef, ref string) []string {
+	if imageRepository(ref) == imageRepository(digestRef) {
+		return []string{"crane", "tag", digestRef, strings.TrimPrefix(ref, imageRepository(ref)+":")}
+	}
+
+	return []string{"crane", "copy", digestRef, ref}
+}
+
+// pushImage pushes the image to ref, returning the published reference
+// including its digest. A bound registry service is pushed to from a
+// container bound to it, with crane over plain HTTP
+func pushImage(
+	ctx context.Context,
+	ctr *dagger.Container,
+	ref string,
+	auth registryAuth,
+) (string, error) {
+	if auth.Service == nil {
+		return ctr.Publish(ctx, ref)
+	}
+
+	crane, err := craneContainer(ctx, auth)
+	if err != nil {
+		return "", err
+	}
+
+	published, err := crane.
+		WithMountedDirectory("/tmp/oci", ociLayout(ctr)).
+		WithExec([]string{"crane", "push", "--insecure", "/tmp/oci", ref}).
+		Stdout(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to push %s: %w", ref, err)
+	}
+
+	return strings.TrimSpace(published), nil
+}
+
+// tagDigest points each of the refs at the published image digestRef with
+// crane, without pushing the image again. crane cannot use the credentials of
+// the Dagger host, without credentials each ref is published from ctr
+// instead, the registry already has its layers and the manifest digest is the
+// same
+func tagDigest(
+	ctx context.Context,
+	ctr *dagger.Container,
+	digestRef string,
+	refs []string,
+	auth registryAuth,
+) error {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	if auth.Service == nil && auth.Password == nil && auth.DockerConfig == nil {
+		_, want, _ := strings.Cut(digestRef, "@")
+		for _, ref := range refs {
+			published, err := ctr.Publish(ctx, ref)
+			if err != nil {
+				return fmt.Errorf("unable to tag %s as %s: %w", digestRef, ref, err)
+			}
+
+			if _, digest, _ := strings.Cut(published, "@"); digest != want {
+				return fmt.Errorf("published %s as %s, want digest %s", ref, published, want)
+			}
+		}
+
+		return nil
+	}
+
+	crane, err := craneContainer(ctx, auth)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		args := craneArgs(digestRef, ref)
+		if auth.Service != nil {
+			args = append(args, "--insecure")
+		}
+
+		_, err := crane.WithExec(args).Sync(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to tag %s as %s: %w", digestRef, ref, err)
+		}
+	}
+
+	return nil
+}
+
+// craneContainer returns a crane container authenticated to the registry
+func craneContainer(ctx context.Context, auth registryAuth) (*dagger.Container, error) {
+	auth.User = craneUser
+	auth.Login = []string{"crane", "auth", "login"}
+
+	return withDockerConfig(
+		ctx,
+		dag.Container().From(craneImage).WithUser(craneUser),
+		auth,
+	)
+}
+
+// checkPushAuth validates the credentials may push to repository by
+// requesting a push token, without credentials the credentials of the Dagger
+// host are used and cannot be validated. Registry services are not validated
+func checkPushAuth(ctx context.Context, auth registryAuth, repository string) error {
+	if auth.Service != nil || (auth.Password == nil && auth.DockerConfig == nil) {
+		return nil
+	}
+
+	crane, err := craneContainer(ctx, auth)
+	if err != nil {
+		return err
+	}
+
+	_, err = crane.
+		WithExec([]string{"crane", "auth", "token", "--push", repository}).
+		Sync(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to authenticate to push %s: %w", repository, err)
+	}
+
+	return nil
+}
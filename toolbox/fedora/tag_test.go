@@ -0,0 +1,39 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCraneArgs(t *testing.T) {
+	t.Parallel()
+
+	digest := "ghcr.io/foo/fedora-toolbox@sha256:abc"
+
+	tests := []struct {
+		name string
+		ref  string
+		want []string
+	}{
+		{
+			name: "same repository",
+			ref:  "ghcr.io/foo/fedora-toolbox:latest",
+			want: []string{"crane", "tag", digest, "latest"},
+		},
+		{
+			name: "other repository",
+			ref:  "quay.io/foo/fedora-toolbox:43",
+			want: []string{"crane", "copy", digest, "quay.io/foo/fedora-toolbox:43"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := craneArgs(digest, tt.ref); !slices.Equal(got, tt.want) {
+				t.Errorf("craneArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
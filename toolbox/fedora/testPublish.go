@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"dagger/toolbox-fedora/internal/dagger"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// registryImage is the ephemeral registry TestPublish publishes to
+	registryImage = "registry:2"
+	// testRegistry is the registry service as bound by registryAuth
+	testRegistry = "registry:5000"
+)
+
+// testCheck is the outcome of a check of a test function
+type testCheck struct {
+	Name    string
+	Failure string
+}
+
+// testReport renders the checks, one per line, and returns an error listing
+// the failed checks, if any
+func testReport(checks []testCheck) (string, error) {
+	out := &strings.Builder{}
+	failed := []string{}
+	for _, check := range checks {
+		if check.Failure == "" {
+			fmt.Fprintf(out, "ok   %s\n", check.Name)
+			continue
+		}
+
+		fmt.Fprintf(out, "FAIL %s: %s\n", check.Name, check.Failure)
+		failed = append(failed, check.Name)
+	}
+
+	if len(failed) > 0 {
+		return out.String(), fmt.Errorf(
+			"%d of %d checks failed: %s\n%s",
+			len(failed),
+			len(checks),
+			strings.Join(failed, ", "),
+			out.String(),
+		)
+	}
+
+	return out.String(), nil
+}
+
+// missingTags returns the wanted tags not in the output of crane ls
+func missingTags(listed string, want []string) []string {
+	tags := strings.Fields(listed)
+
+	missing := []string{}
+	for _, tag := range want {
+		if !slices.Contains(tags, tag) {
+			missing = append(missing, tag)
+		}
+	}
+
+	return missing
+}
+
+// configLabel returns the label of the image config as printed by
+// crane config
+func configLabel(config string, name string) (string, error) {
+	parsed := struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}{}
+	if err := json.Unmarshal([]byte(config), &parsed); err != nil {
+		return "", fmt.Errorf("unable to parse image config: %w", err)
+	}
+
+	return parsed.Config.Labels[name], nil
+}
+
+// testPublishCase is a publish run of TestPublish
+type testPublishCase struct {
+	name                  string
+	username              string
+	skipRegistryNamespace bool
+	// wantRepository is the repository the image must be pushed to
+	wantRepository string
+}
+
+// testPublishCases are the publish runs of TestPublish
+var testPublishCases = []testPublishCase{
+	{
+		name:           "namespaced",
+		username:       "E2E",
+		wantRepository: testRegistry + "/e2e/fedora-toolbox-e2e",
+	},
+	{
+		name:                  "skip registry namespace",
+		username:              "E2E",
+		skipRegistryNamespace: true,
+		wantRepository:        testRegistry + "/fedora-toolbox-e2e",
+	},
+}
+
+// TestPublish publishes the image to an ephemeral registry:2 service, signs
+// and attests it like PublishAndSign with a throwaway cosign key and checks
+// the pushed tags, the lowercase registry namespace, the image title label
+// and the signatures. Nothing but the local service is pushed to. Returns a
+// report of the checks, failing if any check failed
+func (ft *FedoraToolbox) TestPublish(
+	ctx context.Context,
+	// Cosign container image
+	// +optional
+	// +default="chainguard/cosign:latest"
+	cosignImage string,
+	// Cosign container image user
+	// +optional
+	// +default="nonroot"
+	cosignUser string,
+) (string, error) {
+	const imageName = "fedora-toolbox-e2e"
+	tags := []string{"e2e", "e2e-latest"}
+
+	registry := dag.Container().
+		From(registryImage).
+		WithExposedPort(5000).
+		AsService()
+
+	password := dag.SetSecret("e2e-cosign-password", "e2e")
+	keys := dag.Container().
+		From(cosignImage).
+		WithUser(cosignUser).
+		WithSecretVariable("COSIGN_PASSWORD", password).
+		WithExec([]string{"cosign", "generate-key-pair", "--output-key-prefix", "/tmp/e2e"})
+
+	privateKeyPEM, err := keys.File("/tmp/e2e.key").Contents(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate cosign key pair: %w", err)
+	}
+	privateKey := dag.SetSecret("e2e-cosign-key", privateKeyPEM)
+	publicKey := keys.File("/tmp/e2e.pub")
+
+	crane, err := craneContainer(ctx, registryAuth{Registry: testRegistry, Service: registry})
+	if err != nil {
+		return "", err
+	}
+
+	// signed like PublishAndSign, without uploading to the transparency log,
+	// the registry and its service are those of the destination
+	signer := cosignOpts{
+		Image:      cosignImage,
+		User:       cosignUser,
+		PrivateKey: privateKey,
+		Password:   password,
+		SkipTlog:   true,
+	}
+
+	env := &testPublishEnv{
+		crane:       crane,
+		publicKey:   publicKey,
+		registry:    registry,
+		cosignImage: cosignImage,
+		cosignUser:  cosignUser,
+	}
+
+	checks := []testCheck{}
+	for _, tc := range testPublishCases {
+		run := *ft
+		run.Digest, run.Digests, run.PublishedRefs, run.Published = "", nil, nil, nil
+
+		published, err := run.publish(
+			ctx,
+			testRegistry,
+			imageName,
+			tags,
+			tc.username,
+			nil,
+			false,
+			tc.skipRegistryNamespace,
+			true,
+			false,
+			false,
+			false,
+			registry,
+		)
+		if err != nil {
+			return "", fmt.Errorf("%s: unable to publish: %w", tc.name, err)
+		}
+
+		result := run.result(published)
+		signed := run.signPublished(ctx, published, result, signer, false, testRegistry, imageName)
+
+		checks = append(checks, run.testPublished(ctx, env, tc, imageName, tags, signed)...)
+	}
+
+	return testReport(checks)
+}
+
+// testPublishEnv is the registry service and tool containers of TestPublish
+type testPublishEnv struct {
+	crane       *dagger.Container
+	publicKey   *dagger.File
+	registry    *dagger.Service
+	cosignImage string
+	cosignUser  string
+}
+
+// testPublished checks the image published and signed by a TestPublish run
+func (ft *FedoraToolbox) testPublished(
+	ctx context.Context,
+	env *testPublishEnv,
+	tc testPublishCase,
+	imageName string,
+	tags []string,
+	// error of signing the published image, see signPublished
+	signed error,
+) []testCheck {
+	checks := []testCheck{}
+	check := func(name string, failure string) {
+		checks = append(checks, testCheck{Name: tc.name + ": " + name, Failure: failure})
+	}
+
+	repository := imageRepository(ft.PublishedRefs[0])
+	failure := ""
+	if repository != tc.wantRepository {
+		failure = fmt.Sprintf("published to %s, want %s", repository, tc.wantRepository)
+	}
+	check("repository", failure)
+
+	failure = ""
+	listed, err := env.crane.
+		WithExec([]string{"crane", "ls", "--insecure", repository}).
+		Stdout(ctx)
+	if err != nil {
+		failure = err.Error()
+	} else if missing := missingTags(listed, tags); len(missing) > 0 {
+		failure = fmt.Sprintf("missing %s, listed %s",
+			strings.Join(missing, ", "), strings.Join(strings.Fields(listed), ", "))
+	}
+	check("tags", failure)
+
+	failure = ""
+	config, err := env.crane.
+		WithExec([]string{"crane", "config", "--insecure", ft.Digest}).
+		Stdout(ctx)
+	if err != nil {
+		failure = err.Error()
+	} else if title, err := configLabel(config, "org.opencontainers.image.title"); err != nil {
+		failure = err.Error()
+	} else if title != imageName {
+		failure = fmt.Sprintf("org.opencontainers.image.title is %q, want %q", title, imageName)
+	}
+	check("title label", failure)
+
+	if signed != nil {
+		check("signature", fmt.Sprintf("unable to sign: %s", signed))
+		return checks
+	}
+
+	results, err := ft.Verify(
+		ctx,
+		ft.PublishedRefs,
+		env.publicKey,
+		"",
+		"",
+		nil,
+		nil,
+		env.registry,
+		true,
+		true,
+		env.cosignImage,
+		env.cosignUser,
+	)
+	if err != nil {
+		check("signature", err.Error())
+		return checks
+	}
+
+	for _, result := range results {
+		check("signature "+result.Ref, result.Message)
+	}
+
+	return checks
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMissingTags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		listed string
+		want   []string
+		expect []string
+	}{
+		{
+			name:   "all listed",
+			listed: "e2e\ne2e-latest\nsha256-abc.sig\n",
+			want:   []string{"e2e", "e2e-latest"},
+			expect: []string{},
+		},
+		{
+			name:   "missing",
+			listed: "e2e-latest\n",
+			want:   []string{"e2e", "e2e-latest"},
+			expect: []string{"e2e"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := missingTags(tt.listed, tt.want); !slices.Equal(got, tt.expect) {
+				t.Errorf("missingTags() = %v, want %v", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestConfigLabel(t *testing.T) {
+	t.Parallel()
+
+	config := `{"config":{"Labels":{"org.opencontainers.image.title":"fedora-toolbox-e2e"}}}`
+	got, err := configLabel(config, "org.opencontainers.image.title")
+	if err != nil || got != "fedora-toolbox-e2e" {
+		t.Errorf("configLabel() = %q, %v", got, err)
+	}
+
+	if _, err := configLabel("MANIFEST_UNKNOWN", "org.opencontainers.image.title"); err == nil {
+		t.Error("configLabel() of invalid config did not fail")
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestVerifyResult(t *testing.T) {
+	t.Parallel()
+
+	verified := verifyResult("ghcr.io/foo/fedora-toolbox:43", 0,
+		`[{"critical":{"image":{"docker-manifest-digest":"sha256:abc"}}}]`, "")
+	if !verified.Verified || verified.Digest != "sha256:abc" || verified.Signatures != 1 {
+		t.Fatalf("verifyResult(verified) = %+v", *verified)
+	}
+
+	failed := verifyResult("ghcr.io/foo/fedora-toolbox:43", 1, "",
+		"Error: no matching signatures\n")
+	if failed.Verified || failed.Message != "Error: no matching signatures" {
+		t.Fatalf("verifyResult(failed) = %+v", *failed)
+	}
+}